@@ -2,25 +2,53 @@ package balancer
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"sync"
+	"time"
 )
 
-type Client interface {
+var (
+	// ErrClosed is returned when registering to a closed Balancer.
+	ErrClosed = errors.New("balancer closed")
+	// ErrDropped is the error of a chunk taken from a client that was deregistered before the chunk was processed.
+	ErrDropped = errors.New("chunk dropped")
+)
+
+// Client feeds work chunks of type T to the Balancer.
+type Client[T any] interface {
 	// Weight is unit-less number that determines how much processing capacity can a client be allocated
 	// when running in parallel with other clients. The higher the weight, the more capacity the client receives.
 	Weight() int
 	// Workload returns a channel of work chunks that are ment to be processed through the Server.
 	// Client's channel is always filled with work chunks.
-	Workload(ctx context.Context) chan int
+	Workload(ctx context.Context) chan T
 	Id() int
 }
 
-// Server defines methods required to process client's work chunks (requests).
-type Server interface {
-	// Process takes one work chunk (request) and does something with it. The error can be ignored.
-	Process(ctx context.Context, workChunk int) error
+// Server defines methods required to process client's work chunks (requests) of type T with results of type R.
+type Server[T, R any] interface {
+	// Process takes one work chunk (request) and does something with it. A failed chunk is retried according to
+	// the RetryPolicy of the Balancer and its Result is reported to the client.
+	Process(ctx context.Context, workChunk T) (R, error)
+}
+
+// Processor is a Server of chunks that have no result besides the error.
+type Processor[T any] interface {
+	Process(ctx context.Context, workChunk T) error
+}
+
+// WithoutResults makes a Server with empty results of p.
+func WithoutResults[T any](p Processor[T]) Server[T, struct{}] {
+	return processorServer[T]{p}
+}
+
+type processorServer[T any] struct {
+	p Processor[T]
+}
+
+func (s processorServer[T]) Process(ctx context.Context, workChunk T) (struct{}, error) {
+	return struct{}{}, s.p.Process(ctx, workChunk)
 }
 
 // Balancer makes sure the Server is not smashed with incoming requests (work chunks) by only enabling certain number
@@ -36,116 +64,592 @@ type Server interface {
 // two would be allowed to send 25 requests and the other one would send 50. It's likely that the one sending 50 would
 // be served faster, finishing the work early, meaning that it would no longer be necessary that those first two
 // clients only send 25 each but can and should use the remaining capacity and send 50 again.
-type Balancer struct {
+//
+// This is what the default SlotShare policy does, see WithPolicy for the others.
+type Balancer[T, R any] struct {
+	config
 	maxParallel int32
-	clients     []*clientWorkload
-	server      Server
+	clients     []*clientWorkload[T, R]
+	server      Server[T, R]
+	nextKey     uint64
+
+	mux     sync.Mutex
+	cond    *sync.Cond // signalled when a client has a chunk ready, a chunk was taken or a client was removed
+	closed  bool
+	closing chan struct{} // closed by Close, stops taking chunks from clients
+	stopped chan struct{} // closed once the workers have finished
+	slots   chan struct{} // one token per chunk being processed, never more than maxParallel
+	workers sync.WaitGroup
+	metrics metrics
+
+	wakeup   *time.Timer // wakes the scheduler when a throttled client or the breaker may let a chunk through
+	wakeupAt time.Time
+	breaker  *Breaker    // of a protected server, nil if it isn't
+	pool     *Pool[T, R] // the server if it's a Pool, nil if it isn't
+}
+
+type clientWorkload[T, R any] struct {
+	key      uint64
+	ctx      context.Context
+	client   Client[T]
+	workload chan T
+	cancel   context.CancelFunc // stops the client's Workload
 
-	mux  sync.Mutex
-	once sync.Once
-	cond *sync.Cond
+	onResult func(Result[T, R])
+	done     chan struct{} // closed when removed and all chunks are reported
+	usage    *usage        // nil without Limits
+	timeout  time.Duration // of every chunk, 0 for none
+
+	// guarded by Balancer.mux
+	next        Job[T, R]   // the next chunk, taken from workload by the pump
+	ready       bool        // next is waiting for the scheduler
+	retries     []Job[T, R] // failed chunks whose backoff is over, they go before next
+	exhausted   bool        // workload was closed
+	removed     bool
+	outstanding int    // chunks taken by the scheduler without a final result
+	inFlight    int    // chunks being processed
+	throttled   Reason // why the ready chunk waited at the last pick
+	stats       ClientStats
+}
+
+func (cw *clientWorkload[T, R]) report(r Result[T, R]) {
+	if cw.onResult != nil {
+		cw.onResult(r)
+	}
 }
 
-type clientWorkload struct {
-	client   Client
-	workload chan int
+// Registration is a handle of a registered client.
+type Registration[T, R any] struct {
+	b  *Balancer[T, R]
+	cw *clientWorkload[T, R]
+}
+
+// Done returns a channel that's closed when all work of the client was processed, the client was deregistered or
+// the Balancer was closed, and no chunks of the client are being processed.
+func (r *Registration[T, R]) Done() <-chan struct{} {
+	return r.cw.done
+}
+
+// Wait blocks until Done is closed.
+func (r *Registration[T, R]) Wait() {
+	<-r.cw.done
+}
+
+// Stats returns the counts of processed chunks of the client so far.
+func (r *Registration[T, R]) Stats() ClientStats {
+	r.b.mux.Lock()
+	defer r.b.mux.Unlock()
+	return r.cw.stats
+}
+
+// Deregister stops processing the work of this registration only, see Balancer.Deregister.
+func (r *Registration[T, R]) Deregister() {
+	r.b.mux.Lock()
+	defer r.b.mux.Unlock()
+	r.b.remove(r.cw)
 }
 
 // New creates a new Balancer instance. It needs the server that it's going to balance for and a maximum number of work
 // chunks that can the processor process at a time. THIS IS A HARD REQUIREMENT - THE SERVICE CANNOT PROCESS MORE THAN
 // <PROVIDED NUMBER> OF WORK CHUNKS IN PARALLEL.
-func New(server Server, maxParallel int32) *Balancer {
-	b := &Balancer{
+//
+// The workers and the scheduler are started right away and run until Close.
+func New[T, R any](server Server[T, R], maxParallel int32, opts ...Option) *Balancer[T, R] {
+	b := &Balancer[T, R]{
+		config:      config{policy: NewSlotShare()},
 		maxParallel: maxParallel,
 		server:      server,
-		clients:     make([]*clientWorkload, 0),
+		clients:     make([]*clientWorkload[T, R], 0),
+		closing:     make(chan struct{}),
+		stopped:     make(chan struct{}),
+		slots:       make(chan struct{}, maxParallel),
+		metrics:     newMetrics(),
+	}
+	for _, opt := range opts {
+		opt(&b.config)
 	}
 	b.cond = sync.NewCond(&b.mux)
+	if b.budget != nil {
+		b.budget.Notify(b.wake)
+	}
+	if p, ok := server.(protected[T, R]); ok {
+		// the scheduler holds the chunks while the breaker is open, they don't fail with ErrOpen
+		b.server, b.breaker = p.server, p.breaker
+		b.breaker.setNotify(b.wake)
+	}
+	if p, ok := b.server.(*Pool[T, R]); ok {
+		b.pool = p
+		p.setNotify(b.wake)
+	}
+
+	jobs := make(chan Job[T, R])
+	for w := 0; w < int(maxParallel); w++ {
+		b.workers.Add(1)
+		go b.work(jobs)
+	}
+	go func() {
+		b.schedule(jobs)
+		close(jobs)
+		b.workers.Wait()
+		close(b.stopped)
+	}()
 	return b
 }
 
-type Job struct {
-	clientId int
-	workload int
+// wake makes the scheduler check the clients again.
+func (b *Balancer[T, R]) wake() {
+	// the scheduler checks the budget and the breaker with b.mux held, so it can't miss the signal
+	b.mux.Lock()
+	b.cond.Broadcast()
+	b.mux.Unlock()
+}
+
+type Job[T, R any] struct {
+	client   *clientWorkload[T, R]
+	workload T
+	ctx      context.Context // of the chunk, derived from the context of Register with the timeout of the client
+	cancel   context.CancelFunc
+	stop     func() bool // stops expiring the chunk once it's no longer waiting for a slot
+	attempts int
+	cycle    uint64    // of the breaker when the last attempt started
+	value    R         // of the last attempt
+	err      error     // of the last attempt
+	queued   time.Time // when the chunk started waiting for a slot
+}
+
+// work processes jobs in one slot of the server.
+func (b *Balancer[T, R]) work(jobs <-chan Job[T, R]) {
+	defer b.workers.Done()
+	for workItem := range jobs {
+		started := time.Now()
+		workItem.value, workItem.err = b.server.Process(workItem.ctx, workItem.workload)
+		b.complete(workItem, time.Since(started))
+	}
+}
+
+// pick asks the policy which of the ready clients to serve next, b.mux must be held.
+func (b *Balancer[T, R]) pick(ready []*clientWorkload[T, R]) *clientWorkload[T, R] {
+	totalWeight := b.totalWeight()
+	limit := b.limit()
+	if b.budget != nil && b.budget.Slots() < limit {
+		limit = b.budget.Slots()
+	}
+
+	candidates := make([]Candidate, len(ready))
+	for i, cw := range ready {
+		candidates[i] = Candidate{
+			Key:      cw.key,
+			Id:       cw.client.Id(),
+			Weight:   cw.client.Weight(),
+			InFlight: cw.inFlight,
+			Share:    float64(limit) * float64(cw.client.Weight()) / float64(totalWeight),
+		}
+	}
+	return ready[b.policy.Pick(candidates)]
 }
 
-// weightedChoice implements "Weighted random selection" algorithm to randomly select a client to server respecting the weights.
-// if client A has weight of 1 and client B has weight of 3 then B is 3x more likely to be picked.
-func (b *Balancer) weightedChoice() int {
-	totalWeight := 0
+// totalWeight returns the sum of the weights of the registered clients, b.mux must be held.
+func (b *Balancer[T, R]) totalWeight() int {
+	total := 0
 	for _, cw := range b.clients {
-		totalWeight += cw.client.Weight()
+		total += cw.client.Weight()
 	}
+	return total
+}
 
-	randValue := rand.Intn(totalWeight)
+// limit returns the number of chunks that may be processed in parallel now, b.mux must be held.
+func (b *Balancer[T, R]) limit() int {
+	limit := int(b.maxParallel)
+	if b.limiter != nil && b.limiter.Limit() < limit {
+		limit = b.limiter.Limit()
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if b.pool != nil && b.pool.Capacity() < limit {
+		limit = b.pool.Capacity() // 0 without backends
+	}
+	return limit
+}
 
-	for index, cw := range b.clients {
-		if randValue < cw.client.Weight() {
-			return index
+// readyClients returns the registered clients that have a chunk waiting and aren't throttled by their Limits,
+// b.mux must be held.
+func (b *Balancer[T, R]) readyClients() []*clientWorkload[T, R] {
+	var ready []*clientWorkload[T, R]
+	for _, cw := range b.clients {
+		cw.throttled = ""
+		b.expire(cw)
+		if !cw.ready && len(cw.retries) == 0 {
+			continue
 		}
-		randValue -= cw.client.Weight()
+		if cw.usage != nil {
+			reason, until := cw.usage.throttled(len(cw.retries) > 0)
+			if reason != "" {
+				cw.throttled = reason
+				if !until.IsZero() {
+					b.wakeAt(until)
+				}
+				continue
+			}
+		}
+		ready = append(ready, cw)
+	}
+	return ready
+}
+
+// remove stops scheduling cw and its Workload, b.mux must be held. Chunks already handed to the workers are still
+// processed, retries and the chunk waiting for the scheduler are dropped. cw.done is closed once all chunks are
+// reported.
+func (b *Balancer[T, R]) remove(cw *clientWorkload[T, R]) {
+	if cw.removed {
+		return
+	}
+	for i, other := range b.clients {
+		if other == cw {
+			b.clients = append(b.clients[:i], b.clients[i+1:]...)
+			break
+		}
+	}
+	b.policy.Remove(cw.key)
+	cw.removed = true
+	cw.cancel()
+	b.cond.Broadcast()
+
+	var dropped []Result[T, R]
+	if cw.ready {
+		dropped = append(dropped, Result[T, R]{Chunk: cw.next.workload, Err: ErrDropped})
+		cw.next.stop()
+		cw.next.cancel()
+		cw.ready = false
+	}
+	for _, job := range cw.retries {
+		dropped = append(dropped, Result[T, R]{Chunk: job.workload, Err: job.err, Attempts: job.attempts})
+		job.stop()
+		job.cancel()
+		cw.outstanding--
 	}
+	cw.retries = nil
+	b.countStats(cw, func(s *ClientStats) { s.Failed += len(dropped) })
+	last := cw.outstanding == 0
+	go func() {
+		for _, r := range dropped {
+			cw.report(r)
+		}
+		if last {
+			close(cw.done)
+		}
+	}()
+}
 
-	return 0 // not reachable
+// removeIfDone removes a client that has no more work, b.mux must be held.
+func (b *Balancer[T, R]) removeIfDone(cw *clientWorkload[T, R]) {
+	if cw.exhausted && !cw.ready && len(cw.retries) == 0 && cw.outstanding == 0 {
+		b.remove(cw)
+	}
+}
+
+// expire fails the chunks of cw waiting for a slot whose context is done, b.mux must be held. They are reported
+// like the chunks processed for the last time, so that Done is closed only after them.
+func (b *Balancer[T, R]) expire(cw *clientWorkload[T, R]) {
+	var expired []Job[T, R]
+	if cw.ready && cw.next.ctx.Err() != nil {
+		job := cw.next
+		job.err = job.ctx.Err()
+		expired = append(expired, job)
+		cw.ready = false
+		cw.outstanding++
+		b.cond.Broadcast() // the pump can offer the next chunk
+	}
+	retries := cw.retries[:0]
+	for _, job := range cw.retries {
+		if job.ctx.Err() != nil {
+			expired = append(expired, job) // with the error of its last attempt
+		} else {
+			retries = append(retries, job)
+		}
+	}
+	cw.retries = retries
+	for _, job := range expired {
+		go func(job Job[T, R]) {
+			b.mux.Lock()
+			b.finish(job)
+		}(job)
+	}
+}
+
+// expireWhenDone expires the chunks of cw once ctx of its queued chunk is done, the scheduler may be waiting for a
+// slot then and not look at cw until the chunks in flight finish.
+func (b *Balancer[T, R]) expireWhenDone(cw *clientWorkload[T, R], ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, func() {
+		b.mux.Lock()
+		b.expire(cw)
+		b.mux.Unlock()
+	})
+}
+
+// countStats applies f to the stats of cw and to the totals of its client, b.mux must be held.
+func (b *Balancer[T, R]) countStats(cw *clientWorkload[T, R], f func(*ClientStats)) {
+	f(&cw.stats)
+	f(b.metrics.total(cw.client.Id()))
+}
+
+// complete records the attempt of job that ended with job.value and job.err after took. A failed chunk is queued for
+// a retry after its backoff, otherwise its result is reported.
+func (b *Balancer[T, R]) complete(job Job[T, R], took time.Duration) {
+	cw := job.client
+	job.attempts++
+	err := job.err
+
+	b.mux.Lock()
+	b.metrics.latency.observe(took)
+	b.metrics.inFlight--
+	cw.inFlight--
+	if cw.usage != nil {
+		cw.usage.release()
+	}
+	// the slot is free only once the chunk is accounted, so that the next pick and Status don't count it
+	<-b.slots
+	if b.limiter != nil {
+		b.limiter.Observe(took, err)
+	}
+	if b.budget != nil {
+		b.budget.Release()
+	}
+	if b.breaker != nil {
+		if job.ctx.Err() != nil {
+			b.breaker.release(job.cycle)
+		} else {
+			b.breaker.record(job.cycle, err)
+		}
+	}
+	b.cond.Broadcast() // the scheduler may be waiting for the server to get below the limit
+	if err != nil {
+		b.countStats(cw, func(s *ClientStats) { s.Errors++ })
+		if !cw.removed && job.ctx.Err() == nil && b.retry.shouldRetry(job.attempts, err) {
+			b.countStats(cw, func(s *ClientStats) { s.Retries++ })
+			b.mux.Unlock()
+			time.AfterFunc(b.retry.backoff(job.attempts), func() { b.requeue(job) })
+			return
+		}
+	}
+	b.finish(job)
+}
+
+// requeue offers a failed chunk to the scheduler again.
+func (b *Balancer[T, R]) requeue(job Job[T, R]) {
+	cw := job.client
+	b.mux.Lock()
+	if cw.removed || job.ctx.Err() != nil {
+		b.finish(job)
+		return
+	}
+	job.queued = time.Now()
+	job.stop = b.expireWhenDone(cw, job.ctx)
+	cw.retries = append(cw.retries, job)
+	b.mux.Unlock()
+	b.cond.Broadcast()
+}
+
+// finish reports the final result of job. It's called with b.mux held and releases it.
+func (b *Balancer[T, R]) finish(job Job[T, R]) {
+	cw := job.client
+	switch {
+	case job.err == nil:
+		b.countStats(cw, func(s *ClientStats) { s.Succeeded++ })
+	case job.ctx.Err() != nil:
+		b.countStats(cw, func(s *ClientStats) { s.Failed++; s.Expired++ })
+	default:
+		b.countStats(cw, func(s *ClientStats) { s.Failed++ })
+	}
+	job.stop()
+	job.cancel()
+	cw.outstanding--
+	last := cw.removed && cw.outstanding == 0
+	b.removeIfDone(cw)
+	b.mux.Unlock()
+
+	cw.report(Result[T, R]{Chunk: job.workload, Value: job.value, Err: job.err, Attempts: job.attempts})
+	if last {
+		close(cw.done)
+	}
 }
 
 // Register a client to the balancer and start processing its work chunks through provided processor (server).
 // For the sake of simplicity, assume that the client has no identifier, meaning the same client can register themselves
 // multiple times.
-func (b *Balancer) Register(ctx context.Context, client Client) {
+func (b *Balancer[T, R]) Register(ctx context.Context, client Client[T], opts ...RegisterOption) (*Registration[T, R], error) {
+	var rc registerConfig
+	for _, opt := range opts {
+		opt(&rc)
+	}
+	onResult, ok := rc.onResult.(func(Result[T, R]))
+	if rc.onResult != nil && !ok {
+		return nil, fmt.Errorf("OnResult takes a func(%T), got %T", Result[T, R]{}, rc.onResult)
+	}
+
 	b.mux.Lock()
-	fmt.Println("added client: ", client.Id())
-	b.clients = append(b.clients, &clientWorkload{
+	defer b.mux.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.nextKey++
+	workloadCtx, cancel := context.WithCancel(ctx)
+	cw := &clientWorkload[T, R]{
+		key:      b.nextKey,
+		ctx:      ctx,
 		client:   client,
-		workload: client.Workload(ctx),
-	})
+		workload: client.Workload(workloadCtx),
+		cancel:   cancel,
+		onResult: onResult,
+		done:     make(chan struct{}),
+		timeout:  rc.timeout,
+	}
+	cw.usage = rc.usage
+	b.clients = append(b.clients, cw)
+	go b.pump(cw)
+	return &Registration[T, R]{b: b, cw: cw}, nil
+}
+
+// pump takes chunks from the client's workload one at a time and offers them to the scheduler, so that a client that
+// is slow to produce its chunks never holds up the others.
+func (b *Balancer[T, R]) pump(cw *clientWorkload[T, R]) {
+	for {
+		// the next chunk is taken once the scheduler took the ready one, so that none is held while the client is
+		// deregistered
+		b.mux.Lock()
+		for cw.ready && !cw.removed {
+			b.cond.Wait()
+		}
+		removed := cw.removed
+		b.mux.Unlock()
+		if removed {
+			return
+		}
+		workChunk, ok := <-cw.workload
+		if !ok {
+			break
+		}
+
+		b.mux.Lock()
+		if cw.removed {
+			// the client sent it while it was deregistered
+			b.countStats(cw, func(s *ClientStats) { s.Failed++ })
+			b.mux.Unlock()
+			cw.report(Result[T, R]{Chunk: workChunk, Err: ErrDropped})
+			return
+		}
+		if cw.usage != nil && !cw.usage.offer() {
+			b.countStats(cw, func(s *ClientStats) { s.Rejected++ })
+			b.mux.Unlock()
+			cw.report(Result[T, R]{Chunk: workChunk, Err: ErrQuotaExceeded})
+			b.mux.Lock()
+			b.remove(cw)
+			b.mux.Unlock()
+			return
+		}
+		cw.next = Job[T, R]{client: cw, workload: workChunk, queued: time.Now()}
+		if cw.timeout > 0 {
+			cw.next.ctx, cw.next.cancel = context.WithTimeout(cw.ctx, cw.timeout)
+		} else {
+			cw.next.ctx, cw.next.cancel = context.WithCancel(cw.ctx)
+		}
+		cw.next.stop = b.expireWhenDone(cw, cw.next.ctx)
+		cw.ready = true
+		b.mux.Unlock()
+		b.cond.Broadcast()
+	}
+
+	// the channel was closed, work is done --> remove the client once its last chunk was taken
+	b.mux.Lock()
+	cw.exhausted = true
+	b.removeIfDone(cw)
 	b.mux.Unlock()
-	b.cond.Signal() // signal that the number of clients changed (non-zero now)
-
-	b.once.Do(func() { // start the workers
-		// Create a channel for jobs, no more that maxParallel
-		jobs := make(chan Job, b.maxParallel)
-
-		// Start workers
-		for w := 0; w < int(b.maxParallel); w++ {
-			go func(slotId int, jobs <-chan Job) {
-				for workItem := range jobs {
-					fmt.Printf("in slot %v doing work %v for client %v\n", slotId, workItem.workload, workItem.clientId)
-					_ = b.server.Process(ctx, workItem.workload)
-				}
-			}(w, jobs)
-		}
-
-		// Start the scheduling process
-		for {
-			var index int
-			var cw *clientWorkload
-			for {
-				b.mux.Lock()
-				l := len(b.clients)
-
-				if l > 0 {
-					index = b.weightedChoice()
-					cw = b.clients[index]
-					b.mux.Unlock()
-					break
-				}
+}
 
-				// no more clients --> wait for more clients to come
-				b.cond.Wait()
-				continue
-			}
+// schedule hands the chunks of the clients picked by the policy to the workers until Close. A client is picked only
+// once a slot of the server is free, so the choice reflects the clients that are ready at that moment.
+func (b *Balancer[T, R]) schedule(jobs chan<- Job[T, R]) {
+	for {
+		select {
+		case b.slots <- struct{}{}:
+		case <-b.closing:
+			return
+		}
+
+		b.mux.Lock()
+		ready := b.readyClients()
+		for !b.closed && !b.dispatchable(ready) {
+			// no client has work --> wait for more work to come, for the server to get below the adaptive limit or
+			// for a slot of the shared budget
+			b.cond.Wait()
+			ready = b.readyClients()
+		}
+		if b.closed {
+			b.mux.Unlock()
+			<-b.slots
+			return
+		}
+		cw := b.pick(ready)
+		var job Job[T, R]
+		retry := len(cw.retries) > 0
+		if retry {
+			job = cw.retries[0]
+			cw.retries = cw.retries[1:]
+		} else {
+			job = cw.next
+			cw.ready = false
+			cw.outstanding++
+		}
+		job.stop()
+		if cw.usage != nil {
+			cw.usage.take(retry)
+		}
+		if b.breaker != nil {
+			job.cycle = b.breaker.take()
+		}
+		b.metrics.queueWait.observe(time.Since(job.queued))
+		b.metrics.inFlight++
+		cw.inFlight++
+		b.mux.Unlock()
+		b.cond.Broadcast() // the pump can offer the next chunk
 
-			workChunk, ok := <-cw.workload
-			if ok {
-				fmt.Println("picked client: ", cw.client.Id(), " workChunk: ", workChunk)
-				jobs <- Job{cw.client.Id(), workChunk}
+		jobs <- job
+	}
+}
 
-			} else { // if !ok then channel was closed, work is done --> remove the client
-				b.mux.Lock()
-				b.clients = append(b.clients[:index], b.clients[index+1:]...)
-				b.mux.Unlock()
-			}
+// Deregister stops processing the work of all registrations of client. Chunks that are being processed are finished,
+// chunks already taken from the client's workload and not yet processed are dropped and reported as failed.
+func (b *Balancer[T, R]) Deregister(client Client[T]) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, cw := range append([]*clientWorkload[T, R](nil), b.clients...) {
+		if cw.client == client {
+			b.remove(cw)
 		}
-	})
+	}
+}
+
+// Close stops taking work from the clients, waits until the chunks that were already taken are processed and stops
+// the workers. If ctx is done first, Close returns its error and the workers finish in the background.
+func (b *Balancer[T, R]) Close(ctx context.Context) error {
+	b.mux.Lock()
+	if !b.closed {
+		b.closed = true
+		for len(b.clients) > 0 {
+			b.remove(b.clients[0])
+		}
+		if b.wakeup != nil {
+			b.wakeup.Stop()
+		}
+		close(b.closing)
+	}
+	b.mux.Unlock()
+	b.cond.Broadcast()
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
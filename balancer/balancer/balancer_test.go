@@ -0,0 +1,280 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClient feeds n chunks numbered from base, or chunks until ctx is done for n < 0, one every delay.
+type testClient struct {
+	id, weight, n int
+	base          int
+	delay         time.Duration
+}
+
+func (c *testClient) Weight() int { return c.weight }
+func (c *testClient) Id() int     { return c.id }
+
+func (c *testClient) Workload(ctx context.Context) chan int {
+	workload := make(chan int)
+	go func() {
+		defer close(workload)
+		for i := 0; c.n < 0 || i < c.n; i++ {
+			time.Sleep(c.delay)
+			select {
+			case <-ctx.Done():
+				return
+			case workload <- c.base + i:
+			}
+		}
+	}()
+	return workload
+}
+
+// testServer counts processed chunks and the most chunks processed in parallel. The result of a chunk is its double,
+// fail decides its error. A chunk waits for a value from gate if it's set.
+type testServer struct {
+	delay     time.Duration
+	fail      func(workChunk int) error
+	gate      chan struct{}
+	processed int32
+	inFlight  int32
+	peak      int32
+}
+
+func (s *testServer) Process(_ context.Context, workChunk int) (int, error) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	for {
+		peak := atomic.LoadInt32(&s.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&s.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	if s.gate != nil {
+		<-s.gate
+	}
+	atomic.AddInt32(&s.inFlight, -1)
+	atomic.AddInt32(&s.processed, 1)
+	if s.fail != nil {
+		return 2 * workChunk, s.fail(workChunk)
+	}
+	return 2 * workChunk, nil
+}
+
+func TestRegistrationWait(t *testing.T) {
+	server := &testServer{delay: time.Millisecond}
+	b := New[int, int](server, 4)
+
+	r, err := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Wait()
+	if processed := atomic.LoadInt32(&server.processed); processed != 20 {
+		t.Errorf("%d chunks processed when the client finished", processed)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if peak := atomic.LoadInt32(&server.peak); peak > 4 {
+		t.Errorf("%d chunks processed in parallel", peak)
+	}
+	if _, err := b.Register(context.Background(), &testClient{id: 2, weight: 1, n: 1}); !errors.Is(err, ErrClosed) {
+		t.Errorf("registered to a closed balancer: %v", err)
+	}
+}
+
+func TestDeregister(t *testing.T) {
+	server := &testServer{delay: time.Millisecond}
+	b := New[int, int](server, 2)
+
+	endless := &testClient{id: 1, weight: 1, n: -1}
+	r1, _ := b.Register(context.Background(), endless)
+	r2, _ := b.Register(context.Background(), endless)
+	other, _ := b.Register(context.Background(), &testClient{id: 2, weight: 1, n: -1})
+	time.Sleep(20 * time.Millisecond)
+
+	b.Deregister(endless)
+	for _, r := range []*Registration[int, int]{r1, r2} {
+		select {
+		case <-r.Done():
+		case <-time.After(time.Second):
+			t.Fatal("deregistered client not done")
+		}
+	}
+	select {
+	case <-other.Done():
+		t.Fatal("other client stopped by Deregister")
+	default:
+	}
+
+	other.Deregister()
+	other.Wait()
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chanClient feeds the chunks sent to it, it keeps feeding them after its context is done.
+type chanClient chan int
+
+func (c chanClient) Weight() int                       { return 1 }
+func (c chanClient) Id() int                           { return 1 }
+func (c chanClient) Workload(context.Context) chan int { return c }
+
+func TestDeregisterReportsTakenChunks(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	b := New[int, int](server, 1)
+	defer b.Close(context.Background())
+
+	client := make(chanClient)
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), client, onResult)
+	client <- 1
+	waitFor(t, "the chunk being processed", func() bool { return atomic.LoadInt32(&server.inFlight) == 1 })
+	r.Deregister()
+	// the pump may be taking the next chunk already, it must report it then
+	taken := 1
+	select {
+	case client <- 2:
+		taken++
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case client <- 3:
+		t.Error("a chunk taken from a deregistered client")
+	case <-time.After(10 * time.Millisecond):
+	}
+	server.gate <- struct{}{}
+	r.Wait()
+
+	waitFor(t, "all results", func() bool { return len(results()) == taken })
+	for _, result := range results() {
+		if (result.Chunk == 2) != errors.Is(result.Err, ErrDropped) {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	if stats := r.Stats(); stats.Succeeded != 1 || stats.Failed != taken-1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	server := &testServer{delay: 20 * time.Millisecond}
+	b := New[int, int](server, 3)
+
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: -1})
+	time.Sleep(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.Wait()
+	if inFlight := atomic.LoadInt32(&server.inFlight); inFlight != 0 {
+		t.Errorf("%d chunks still processed after Close", inFlight)
+	}
+
+	// a second Close is a no-op
+	if err := b.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	server := &testServer{delay: 200 * time.Millisecond}
+	b := New[int, int](server, 1)
+	b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 1})
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestCloseUnused(t *testing.T) {
+	b := New[int, int](&testServer{}, 1)
+	if err := b.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSlowClient(t *testing.T) {
+	server := &testServer{}
+	b := New[int, int](server, 2, WithPolicy(NewRoundRobin()))
+	defer b.Close(context.Background())
+
+	b.Register(context.Background(), &testClient{id: 1, weight: 1, n: -1, delay: 50 * time.Millisecond})
+	fast, _ := b.Register(context.Background(), &testClient{id: 2, weight: 1, n: 100})
+	select {
+	case <-fast.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("the slow client holds up the fast one, %d chunks processed", atomic.LoadInt32(&server.processed))
+	}
+}
+
+type word string
+
+// words feeds its words as chunks.
+type words []string
+
+func (w words) Weight() int { return 1 }
+func (w words) Id() int     { return 1 }
+
+func (w words) Workload(ctx context.Context) chan word {
+	workload := make(chan word)
+	go func() {
+		defer close(workload)
+		for _, s := range w {
+			select {
+			case <-ctx.Done():
+				return
+			case workload <- word(s):
+			}
+		}
+	}()
+	return workload
+}
+
+type upperServer struct{}
+
+func (upperServer) Process(_ context.Context, w word) (string, error) {
+	return strings.ToUpper(string(w)), nil
+}
+
+func TestTypedChunks(t *testing.T) {
+	b := New[word, string](upperServer{}, 2)
+	defer b.Close(context.Background())
+
+	var mu sync.Mutex
+	upper := map[word]string{}
+	r, err := b.Register(context.Background(), words{"fly", "me", "to", "prague"}, OnResult(func(r Result[word, string]) {
+		mu.Lock()
+		upper[r.Chunk] = r.Value
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(upper) != 4 || upper["fly"] != "FLY" || upper["prague"] != "PRAGUE" {
+		t.Errorf("unexpected results %v", upper)
+	}
+
+	// results of other types can't be delivered
+	if _, err := b.Register(context.Background(), words{"x"}, OnResult(func(Result[int, int]) {})); err == nil {
+		t.Error("registered with OnResult of other types")
+	}
+}
@@ -0,0 +1,257 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by a protected Server without processing the chunk while its Breaker is open.
+var ErrOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	Closed   BreakerState = iota // chunks are processed
+	Open                         // no chunk is processed until OpenFor is over and the server is healthy
+	HalfOpen                     // Probes chunks are processed, the breaker closes if all of them succeed
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// Breaker is a circuit breaker that stops sending chunks to a failing server to let it recover. It opens when
+// ErrorRate of the last Window chunks failed, never for an ErrorRate of 0 or less. After OpenFor it lets Probes chunks
+// through and closes again if all of them succeed, or opens for another OpenFor if one fails. A chunk whose context
+// ends before the server answers is not counted. An active health check, see Watch, keeps it open while the server
+// is unhealthy.
+//
+// A Breaker guards a Server by Protect. A Balancer of a protected Server pauses the dispatch while the breaker is open
+// instead of failing the chunks.
+type Breaker struct {
+	ErrorRate   float64
+	Window      int
+	MinRequests int // chunks in the window before the breaker can open
+	OpenFor     time.Duration
+	Probes      int
+	// IsFailure reports whether an error of the server counts as its failure, nil for all errors but
+	// context.Canceled: a chunk cancelled by its client says nothing about the server.
+	IsFailure func(err error) bool
+
+	mu       sync.Mutex
+	now      func() time.Time
+	state    BreakerState
+	cycle    uint64 // changes with the state, results of the chunks started in another cycle are ignored
+	outcomes []bool // failures of the last chunks, a ring of Window
+	next     int
+	failures int
+	until    time.Time // end of OpenFor
+	probes   int       // chunks let through half-open
+	passed   int       // probes that succeeded
+	healthy  bool
+	notify   func()
+}
+
+// NewBreaker creates a Breaker opening when errorRate of the last window chunks failed for openFor, with 1 probe. With
+// an errorRate of 0 only the health check opens it.
+func NewBreaker(errorRate float64, window int, openFor time.Duration) *Breaker {
+	return &Breaker{ErrorRate: errorRate, Window: window, MinRequests: window, OpenFor: openFor, Probes: 1,
+		now: time.Now, healthy: true}
+}
+
+// State returns the current state.
+func (br *Breaker) State() BreakerState {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.advance()
+	return br.state
+}
+
+// advance half-opens the breaker once OpenFor is over and the server is healthy, br.mu must be held.
+func (br *Breaker) advance() {
+	if br.state == Open && br.healthy && !br.now().Before(br.until) {
+		br.state, br.probes, br.passed = HalfOpen, 0, 0
+		br.cycle++
+	}
+}
+
+// allows reports whether a chunk may be processed now and otherwise when it may be at the earliest, zero if that
+// depends on a probe or on the health check.
+func (br *Breaker) allows() (bool, time.Time) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.allowed()
+}
+
+// allowed is allows with br.mu held.
+func (br *Breaker) allowed() (bool, time.Time) {
+	br.advance()
+	switch br.state {
+	case Closed:
+		return true, time.Time{}
+	case HalfOpen:
+		return br.probes < br.Probes, time.Time{}
+	}
+	if br.healthy {
+		return false, br.until
+	}
+	return false, time.Time{}
+}
+
+// take counts a chunk sent to the server and returns the cycle to record its result for.
+func (br *Breaker) take() uint64 {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.taken()
+}
+
+// taken is take with br.mu held.
+func (br *Breaker) taken() uint64 {
+	if br.state == HalfOpen {
+		br.probes++
+	}
+	return br.cycle
+}
+
+// acquire takes a chunk if it may be processed now.
+func (br *Breaker) acquire() (uint64, bool) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if ok, _ := br.allowed(); !ok {
+		return 0, false
+	}
+	return br.taken(), true
+}
+
+// record the result of a chunk taken in cycle.
+func (br *Breaker) record(cycle uint64, err error) {
+	failed := err != nil
+	if br.IsFailure != nil {
+		failed = failed && br.IsFailure(err)
+	} else {
+		failed = failed && !errors.Is(err, context.Canceled)
+	}
+
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if cycle != br.cycle {
+		return
+	}
+	switch br.state {
+	case HalfOpen:
+		if failed {
+			br.trip()
+		} else if br.passed++; br.passed >= br.Probes {
+			br.state = Closed
+			br.cycle++
+		}
+	case Closed:
+		if len(br.outcomes) < br.Window {
+			br.outcomes = append(br.outcomes, failed)
+		} else {
+			if br.outcomes[br.next] {
+				br.failures--
+			}
+			br.outcomes[br.next] = failed
+			br.next = (br.next + 1) % br.Window
+		}
+		if failed {
+			br.failures++
+		}
+		if br.ErrorRate > 0 && len(br.outcomes) >= br.MinRequests && float64(br.failures) >= br.ErrorRate*float64(len(br.outcomes)) {
+			br.trip()
+		}
+	}
+}
+
+// release gives back a chunk taken in cycle whose context ended before the server answered: its result says nothing
+// about the server, a probe is let through again instead.
+func (br *Breaker) release(cycle uint64) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if cycle == br.cycle && br.state == HalfOpen {
+		br.probes--
+	}
+}
+
+// trip opens the breaker for OpenFor, br.mu must be held.
+func (br *Breaker) trip() {
+	br.state, br.until = Open, br.now().Add(br.OpenFor)
+	br.cycle++
+	br.outcomes, br.next, br.failures = br.outcomes[:0], 0, 0
+}
+
+// Watch checks the health of the server every interval until ctx is done. A failed check opens the breaker, it
+// stays open until a check succeeds.
+func (br *Breaker) Watch(ctx context.Context, check func(ctx context.Context) error, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		healthy := check(ctx) == nil
+		if ctx.Err() != nil {
+			return
+		}
+		br.mu.Lock()
+		changed := healthy != br.healthy
+		br.healthy = healthy
+		if !healthy && br.state != Open {
+			br.trip()
+		}
+		notify := br.notify
+		br.mu.Unlock()
+		if changed && notify != nil {
+			notify()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setNotify sets the function called when the server got healthy or unhealthy.
+func (br *Breaker) setNotify(f func()) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.notify = f
+}
+
+// Protect makes a Server of server that processes the chunks only while br lets them through and fails them with
+// ErrOpen otherwise.
+func Protect[T, R any](server Server[T, R], br *Breaker) Server[T, R] {
+	return protected[T, R]{server: server, breaker: br}
+}
+
+type protected[T, R any] struct {
+	server  Server[T, R]
+	breaker *Breaker
+}
+
+func (p protected[T, R]) Process(ctx context.Context, workChunk T) (R, error) {
+	cycle, ok := p.breaker.acquire()
+	if !ok {
+		var zero R
+		return zero, ErrOpen
+	}
+	value, err := p.server.Process(ctx, workChunk)
+	if ctx.Err() != nil {
+		p.breaker.release(cycle)
+	} else {
+		p.breaker.record(cycle, err)
+	}
+	return value, err
+}
@@ -0,0 +1,156 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	br := NewBreaker(0.5, 4, time.Second)
+	br.Probes = 2
+	br.now = func() time.Time { return now }
+
+	for _, err := range []error{nil, errTest, nil, context.Canceled, errTest} {
+		if br.State() != Closed {
+			t.Fatalf("open before %v", err)
+		}
+		br.record(br.take(), err)
+	}
+	if ok, until := br.allows(); br.State() != Open || ok || !until.Equal(now.Add(time.Second)) {
+		t.Fatalf("%v allows %v until %v", br.State(), ok, until)
+	}
+	stale := br.take()
+
+	now = now.Add(time.Second)
+	probes := 0
+	for {
+		if _, ok := br.acquire(); !ok {
+			break
+		}
+		probes++
+	}
+	if br.State() != HalfOpen || probes != 2 {
+		t.Fatalf("%v with %d probes", br.State(), probes)
+	}
+	br.record(stale, errTest) // started before the breaker opened
+	br.record(br.cycle, nil)
+	br.record(br.cycle, nil)
+	if br.State() != Closed {
+		t.Fatalf("%v after the probes succeeded", br.State())
+	}
+
+	br.trip()
+	now = now.Add(time.Second)
+	cycle, _ := br.acquire()
+	br.record(cycle, errTest)
+	if br.State() != Open {
+		t.Errorf("%v after a probe failed", br.State())
+	}
+}
+
+func TestProtect(t *testing.T) {
+	server := &testServer{fail: func(int) error { return errTest }}
+	br := NewBreaker(1, 2, time.Hour)
+	protected := Protect[int, int](server, br)
+	for i := 0; i < 3; i++ {
+		protected.Process(context.Background(), i)
+	}
+	if _, err := protected.Process(context.Background(), 3); !errors.Is(err, ErrOpen) || server.processed != 2 {
+		t.Errorf("got %v after %d chunks", err, server.processed)
+	}
+}
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	br := NewBreaker(0.5, 4, time.Second)
+	br.now = func() time.Time { return now }
+	br.trip()
+	now = now.Add(time.Second)
+
+	server := &testServer{fail: func(int) error { return context.Canceled }}
+	protected := Protect[int, int](server, br)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	protected.Process(ctx, 1)
+	if ok, _ := br.allows(); br.State() != HalfOpen || !ok {
+		t.Fatalf("%v allows %v after a canceled probe", br.State(), ok)
+	}
+	server.fail = nil
+	if _, err := protected.Process(context.Background(), 2); err != nil || br.State() != Closed {
+		t.Errorf("%v after the probe got %v", br.State(), err)
+	}
+}
+
+func TestBalancerBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	server := &testServer{delay: time.Millisecond, fail: func(int) error {
+		if failing.Load() {
+			return errTest
+		}
+		return nil
+	}}
+	br := NewBreaker(0.5, 10, 50*time.Millisecond)
+	b := New(Protect[int, int](server, br), 4)
+	defer b.Close(context.Background())
+
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 100}, onResult)
+	waitFor(t, "an open breaker", func() bool { return b.Status().Breaker == "open" })
+	// the chunks in flight when it opened are the last ones until it half-opens
+	time.Sleep(5 * time.Millisecond)
+	processed := atomic.LoadInt32(&server.processed)
+	time.Sleep(20 * time.Millisecond)
+	if now := atomic.LoadInt32(&server.processed); now != processed {
+		t.Errorf("%d chunks processed while the breaker was open", now-processed)
+	}
+
+	failing.Store(false)
+	r.Wait()
+	if br.State() != Closed {
+		t.Errorf("the breaker is %v", br.State())
+	}
+	for _, result := range results() {
+		if errors.Is(result.Err, ErrOpen) {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+	if stats := r.Stats(); stats.Succeeded+stats.Failed != 100 || stats.Failed > 20 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBreakerWatch(t *testing.T) {
+	var healthy atomic.Bool
+	br := NewBreaker(0.5, 10, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go br.Watch(ctx, func(context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errTest
+	}, time.Millisecond)
+
+	waitFor(t, "an open breaker", func() bool { return br.State() == Open })
+	time.Sleep(30 * time.Millisecond)
+	if br.State() != Open {
+		t.Errorf("the breaker is %v with an unhealthy server", br.State())
+	}
+	healthy.Store(true)
+	waitFor(t, "a half-open breaker", func() bool { return br.State() == HalfOpen })
+}
+
+func TestBreakerWithoutErrorRate(t *testing.T) {
+	br := NewBreaker(0, 4, time.Second)
+	for i := 0; i < 8; i++ {
+		br.record(br.take(), errTest)
+	}
+	if br.State() != Closed {
+		t.Errorf("%v without an error rate", br.State())
+	}
+}
@@ -0,0 +1,44 @@
+package balancer
+
+// Budget is the part of the server's slots leased by this replica from a budget shared by several replicas of the
+// Balancer, so that they never process more than the hard limit of the server together, see package budget. A
+// chunk is processed only with a slot of the Budget on top of the limits of the Balancer.
+//
+// The Balancer calls the methods with its lock held, they must not block.
+type Budget interface {
+	// Acquire takes a leased slot for a chunk, false if all of them are taken.
+	Acquire() bool
+	// Release returns the slot of a processed chunk.
+	Release()
+	// Demand reports the total weight of the registered clients and whether a chunk waits only for a leased slot.
+	Demand(weight int, waiting bool)
+	// Slots returns the number of slots leased now.
+	Slots() int
+	// Notify sets the function to call without holding any lock of the Budget when it leased more slots.
+	Notify(f func())
+}
+
+// WithBudget makes the Balancer share the server with other replicas by b.
+func WithBudget(b Budget) Option {
+	return func(c *config) {
+		c.budget = b
+	}
+}
+
+// dispatchable reports whether a chunk of the ready clients can be processed now and takes a slot of the budget for
+// it, b.mux must be held.
+func (b *Balancer[T, R]) dispatchable(ready []*clientWorkload[T, R]) bool {
+	waiting := len(ready) > 0 && b.metrics.inFlight < b.limit()
+	if waiting && b.breaker != nil {
+		allowed, until := b.breaker.allows()
+		if !until.IsZero() {
+			b.wakeAt(until)
+		}
+		waiting = allowed
+	}
+	if b.budget == nil {
+		return waiting
+	}
+	b.budget.Demand(b.totalWeight(), waiting)
+	return waiting && b.budget.Acquire()
+}
@@ -0,0 +1,87 @@
+package balancer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixedBudget leases the slots set by grant.
+type fixedBudget struct {
+	mu          sync.Mutex
+	slots, used int
+	acquired    int
+	weight      int
+	waiting     bool
+	notify      func()
+}
+
+func (b *fixedBudget) Acquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used >= b.slots {
+		return false
+	}
+	b.used++
+	b.acquired++
+	return true
+}
+
+func (b *fixedBudget) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used--
+}
+
+func (b *fixedBudget) Demand(weight int, waiting bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.weight, b.waiting = weight, waiting
+}
+
+func (b *fixedBudget) Slots() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.slots
+}
+
+func (b *fixedBudget) Notify(f func()) {
+	b.notify = f
+}
+
+func (b *fixedBudget) grant(slots int) {
+	b.mu.Lock()
+	b.slots = slots
+	b.mu.Unlock()
+	b.notify()
+}
+
+func TestBudget(t *testing.T) {
+	budget := &fixedBudget{}
+	server := &testServer{delay: time.Millisecond}
+	b := New[int, int](server, 10, WithBudget(budget))
+	defer b.Close(context.Background())
+
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 3, n: 50})
+	waitFor(t, "the demand for slots", func() bool {
+		budget.mu.Lock()
+		defer budget.mu.Unlock()
+		return budget.waiting && budget.weight == 3
+	})
+	if processed := atomic.LoadInt32(&server.processed); processed != 0 {
+		t.Fatalf("%d chunks processed without slots", processed)
+	}
+
+	budget.grant(4)
+	r.Wait()
+	if peak := atomic.LoadInt32(&server.peak); peak != 4 {
+		t.Errorf("%d chunks processed in parallel with 4 slots", peak)
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	if budget.acquired != 50 || budget.used != 0 {
+		t.Errorf("%d slots acquired, %d not released", budget.acquired, budget.used)
+	}
+}
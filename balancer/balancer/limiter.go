@@ -0,0 +1,57 @@
+package balancer
+
+import (
+	"math"
+	"time"
+)
+
+// Limiter adapts the number of chunks processed in parallel to how the Server copes. The Balancer never exceeds
+// maxParallel whatever the Limit, and it serialises the calls, so a Limiter doesn't need locking.
+type Limiter interface {
+	// Limit returns the number of chunks that may be processed in parallel now.
+	Limit() int
+	// Observe records a chunk that took latency to process and failed with err.
+	Observe(latency time.Duration, err error)
+}
+
+// WithLimiter adapts the parallelism by l between 1 and maxParallel, by default it's always maxParallel.
+func WithLimiter(l Limiter) Option {
+	return func(c *config) {
+		c.limiter = l
+	}
+}
+
+// AIMD is an additive increase, multiplicative decrease limiter like the congestion control of TCP. Every chunk that
+// succeeds within Threshold increases the limit by 1/limit, i.e. by one per limit chunks. A failed or slow chunk
+// multiplies it by Backoff. After a decrease the chunks that were already in flight are not counted, they were
+// started under the old limit.
+type AIMD struct {
+	Min, Max  int
+	Threshold time.Duration
+	Backoff   float64
+
+	limit    float64
+	cooldown int // observations to skip after a decrease
+}
+
+// NewAIMD creates an AIMD limiter between min and max starting at min, backing off by 0.75.
+func NewAIMD(min, max int, threshold time.Duration) *AIMD {
+	return &AIMD{Min: min, Max: max, Threshold: threshold, Backoff: 0.75, limit: float64(min)}
+}
+
+func (l *AIMD) Limit() int {
+	return int(math.Floor(l.limit))
+}
+
+func (l *AIMD) Observe(latency time.Duration, err error) {
+	if l.cooldown > 0 {
+		l.cooldown--
+		return
+	}
+	if err != nil || latency > l.Threshold {
+		l.cooldown = l.Limit()
+		l.limit = math.Max(float64(l.Min), l.limit*l.Backoff)
+		return
+	}
+	l.limit = math.Min(float64(l.Max), l.limit+1/l.limit)
+}
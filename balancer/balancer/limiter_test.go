@@ -0,0 +1,82 @@
+package balancer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fragileLatency simulates a server that slows down beyond knee chunks in parallel.
+func fragileLatency(parallel, knee int) time.Duration {
+	if parallel <= knee {
+		return 10 * time.Millisecond
+	}
+	return time.Duration(parallel) * 10 * time.Millisecond / time.Duration(knee)
+}
+
+func TestAIMDConvergence(t *testing.T) {
+	const knee = 30
+	l := NewAIMD(2, 50, 12*time.Millisecond) // slower than 12ms means more than 36 in parallel
+
+	var sum int
+	for round := 0; round < 300; round++ {
+		limit := l.Limit()
+		if limit < l.Min || limit > l.Max {
+			t.Fatalf("round %d: limit %d out of bounds", round, limit)
+		}
+		if round >= 200 {
+			// it probes one chunk above 36 and backs off
+			if limit < 37*3/4 || limit > 37 {
+				t.Errorf("round %d: limit %d doesn't oscillate around the overload point", round, limit)
+			}
+			sum += limit
+		}
+		for i := 0; i < limit; i++ {
+			l.Observe(fragileLatency(limit, knee), nil)
+		}
+	}
+	if mean := float64(sum) / 100; mean < 28 {
+		t.Errorf("mean limit %.1f under-utilises the server", mean)
+	}
+}
+
+func TestAIMDErrors(t *testing.T) {
+	l := NewAIMD(2, 50, time.Second)
+	for i := 0; i < 3000; i++ {
+		l.Observe(time.Millisecond, nil)
+	}
+	if l.Limit() != 50 {
+		t.Fatalf("limit %d didn't reach the maximum", l.Limit())
+	}
+	for i := 0; i < 1000; i++ {
+		l.Observe(time.Millisecond, errTest)
+	}
+	if l.Limit() != 2 {
+		t.Errorf("limit %d didn't fall to the minimum", l.Limit())
+	}
+}
+
+type fixedLimiter int
+
+func (l fixedLimiter) Limit() int                   { return int(l) }
+func (l fixedLimiter) Observe(time.Duration, error) {}
+
+func TestBalancerLimiter(t *testing.T) {
+	for _, tc := range []struct {
+		limit, maxParallel int
+		peak               int32
+	}{
+		{limit: 3, maxParallel: 10, peak: 3},
+		{limit: 100, maxParallel: 4, peak: 4}, // never above the hard limit
+	} {
+		server := &testServer{delay: time.Millisecond}
+		b := New[int, int](server, int32(tc.maxParallel), WithLimiter(fixedLimiter(tc.limit)))
+		r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 100})
+		r.Wait()
+		b.Close(context.Background())
+		if peak := atomic.LoadInt32(&server.peak); peak != tc.peak {
+			t.Errorf("limit %d, max %d: %d chunks in parallel", tc.limit, tc.maxParallel, peak)
+		}
+	}
+}
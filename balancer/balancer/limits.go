@@ -0,0 +1,160 @@
+package balancer
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrQuotaExceeded is the error of the chunk a client offered after it used up its Limits.Quota. The client is
+// deregistered with it.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Reason why a client that has a chunk ready isn't served.
+type Reason string
+
+const (
+	RateLimited        Reason = "rate"        // Limits.Rate
+	ConcurrencyLimited Reason = "concurrency" // Limits.MaxInFlight
+	DailyQuotaExceeded Reason = "daily-quota" // Limits.DailyQuota, the chunk waits for the next day
+)
+
+// Limits caps what a client may use of the server whatever its weight, so that even a client registered alone
+// can't take all of it. The zero value of a field doesn't limit.
+type Limits struct {
+	// Rate of chunks per second given to the server, a token bucket refilled by Rate up to Burst chunks, at least 1.
+	// Retried chunks are counted too.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	// MaxInFlight chunks of the client processed in parallel.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+	// Quota of chunks of the registration, or of all registrations sharing the Limits, the next one fails with
+	// ErrQuotaExceeded. DailyQuota of chunks in a UTC day, the chunks over it wait for the next day.
+	Quota      int `json:"quota,omitempty"`
+	DailyQuota int `json:"dailyQuota,omitempty"`
+}
+
+// WithLimits caps the usage of the server by the client.
+func WithLimits(l Limits) RegisterOption {
+	return func(rc *registerConfig) {
+		rc.usage = newUsage(l)
+	}
+}
+
+// SharedLimits are Limits counted together for all the registrations given them by WithSharedLimits, e.g. for a
+// client that registers once per connection. Quota is then the quota of all of them. SharedLimits may be used with a
+// single Balancer only.
+type SharedLimits struct {
+	usage *usage
+}
+
+// NewSharedLimits creates SharedLimits of l.
+func NewSharedLimits(l Limits) *SharedLimits {
+	return &SharedLimits{usage: newUsage(l)}
+}
+
+// WithSharedLimits caps the usage of the server by the client together with the other registrations of s.
+func WithSharedLimits(s *SharedLimits) RegisterOption {
+	return func(rc *registerConfig) {
+		rc.usage = s.usage
+	}
+}
+
+// usage of a client limited by Limits, guarded by Balancer.mux.
+type usage struct {
+	Limits
+	now func() time.Time
+
+	tokens   float64
+	refilled time.Time
+	inFlight int       // chunks being processed
+	used     int       // chunks offered by the client, not only taken, so that a shared Quota is not overrun
+	day      time.Time // start of the day of usedToday
+	today    int
+}
+
+func newUsage(l Limits) *usage {
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+	u := &usage{Limits: l, now: time.Now, tokens: float64(l.Burst)}
+	u.refilled = u.now()
+	return u
+}
+
+// offer counts a chunk offered by the client, it reports false without counting it if the client used up its Quota.
+func (u *usage) offer() bool {
+	if u.Quota > 0 && u.used >= u.Quota {
+		return false
+	}
+	u.used++
+	return true
+}
+
+// throttled returns why a chunk of the client, a retry if retry, can't be given to the server now, and when it may be
+// at the earliest, zero if it depends on the chunks in flight. The reason is empty if it can.
+func (u *usage) throttled(retry bool) (Reason, time.Time) {
+	now := u.now()
+	u.refill(now)
+	if u.MaxInFlight > 0 && u.inFlight >= u.MaxInFlight {
+		return ConcurrencyLimited, time.Time{}
+	}
+	if !retry && u.DailyQuota > 0 && u.today >= u.DailyQuota {
+		if day := now.Truncate(24 * time.Hour); day.After(u.day) {
+			u.day, u.today = day, 0
+		} else {
+			return DailyQuotaExceeded, u.day.Add(24 * time.Hour)
+		}
+	}
+	if u.Rate > 0 && u.tokens < 1 {
+		wait := time.Duration(math.Ceil((1 - u.tokens) / u.Rate * float64(time.Second)))
+		return RateLimited, now.Add(wait)
+	}
+	return "", time.Time{}
+}
+
+func (u *usage) refill(now time.Time) {
+	if u.Rate > 0 {
+		u.tokens = math.Min(float64(u.Burst), u.tokens+now.Sub(u.refilled).Seconds()*u.Rate)
+	}
+	u.refilled = now
+}
+
+// take counts a chunk given to the server, a retry if retry.
+func (u *usage) take(retry bool) {
+	u.inFlight++
+	if u.Rate > 0 {
+		u.tokens--
+	}
+	if retry {
+		return
+	}
+	if day := u.now().Truncate(24 * time.Hour); day.After(u.day) {
+		u.day, u.today = day, 0
+	}
+	u.today++
+}
+
+// wakeAt makes the scheduler check the clients and the breaker again at t unless it's already woken up earlier, b.mux must be held.
+func (b *Balancer[T, R]) wakeAt(t time.Time) {
+	if b.wakeup != nil && !b.wakeupAt.After(t) {
+		return
+	}
+	if b.wakeup != nil {
+		b.wakeup.Stop()
+	}
+	b.wakeupAt = t
+	b.wakeup = time.AfterFunc(time.Until(t), func() {
+		b.mux.Lock()
+		if b.wakeupAt.Equal(t) {
+			b.wakeup = nil
+		}
+		b.cond.Broadcast()
+		b.mux.Unlock()
+	})
+}
+
+// release counts a chunk processed by the server.
+func (u *usage) release() {
+	u.inFlight--
+}
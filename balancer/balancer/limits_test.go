@@ -0,0 +1,123 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	b := New[int, int](server, 10)
+	defer b.Close(context.Background())
+
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 20}, WithLimits(Limits{MaxInFlight: 3}))
+	waitFor(t, "a throttled client", func() bool {
+		status := b.Status()
+		return status.InFlight == 3 && status.Clients[0].Throttled == ConcurrencyLimited
+	})
+	close(server.gate)
+	r.Wait()
+	if peak := atomic.LoadInt32(&server.peak); peak != 3 {
+		t.Errorf("%d chunks of the client processed in parallel", peak)
+	}
+}
+
+func TestSharedLimits(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	b := New[int, int](server, 10)
+	defer b.Close(context.Background())
+
+	limits := NewSharedLimits(Limits{MaxInFlight: 3, Quota: 15})
+	r1, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 10}, WithSharedLimits(limits))
+	r2, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 10}, WithSharedLimits(limits))
+	waitFor(t, "throttled clients", func() bool {
+		status := b.Status()
+		return status.InFlight == 3 && status.Clients[0].Throttled == ConcurrencyLimited &&
+			status.Clients[1].Throttled == ConcurrencyLimited
+	})
+	close(server.gate)
+	r1.Wait()
+	r2.Wait()
+	if peak := atomic.LoadInt32(&server.peak); peak != 3 {
+		t.Errorf("%d chunks of the registrations processed in parallel", peak)
+	}
+	if processed := atomic.LoadInt32(&server.processed); processed != 15 {
+		t.Errorf("%d chunks processed with a shared quota of 15", processed)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	b := New[int, int](&testServer{}, 10)
+	defer b.Close(context.Background())
+
+	started := time.Now()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 45}, WithLimits(Limits{Rate: 200, Burst: 5}))
+	r.Wait()
+	// the burst goes right away, the other 40 chunks take 200ms
+	if took := time.Since(started); took < 190*time.Millisecond || took > time.Second {
+		t.Errorf("45 chunks took %v", took)
+	}
+	if stats := r.Stats(); stats.Succeeded != 45 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	b := New[int, int](&testServer{}, 4)
+	defer b.Close(context.Background())
+
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: -1}, onResult, WithLimits(Limits{Quota: 10}))
+	select {
+	case <-r.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the client wasn't deregistered at its quota")
+	}
+	if stats := r.Stats(); stats != (ClientStats{Succeeded: 10, Rejected: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	rejected := 0
+	for _, result := range results() {
+		if errors.Is(result.Err, ErrQuotaExceeded) {
+			rejected++
+			if result.Chunk != 10 || result.Attempts != 0 {
+				t.Errorf("unexpected rejection %+v", result)
+			}
+		}
+	}
+	if rejected != 1 {
+		t.Errorf("%d chunks rejected", rejected)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	u := newUsage(Limits{DailyQuota: 2})
+	u.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if reason, _ := u.throttled(false); reason != "" {
+			t.Fatalf("chunk %d throttled by %s", i, reason)
+		}
+		u.take(false)
+	}
+	reason, until := u.throttled(false)
+	if reason != DailyQuotaExceeded || !until.Equal(time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("throttled by %q until %v", reason, until)
+	}
+	if reason, _ := u.throttled(true); reason != "" {
+		t.Errorf("a retry throttled by %s", reason)
+	}
+
+	now = now.Add(time.Hour)
+	if reason, _ := u.throttled(false); reason != "" {
+		t.Errorf("throttled by %s the next day", reason)
+	}
+	u.take(false)
+	if u.today != 1 {
+		t.Errorf("%d chunks today", u.today)
+	}
+}
@@ -0,0 +1,227 @@
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultBuckets are the upper bounds in seconds of the histogram buckets, the same as Prometheus client defaults.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram of durations in the Prometheus sense: counts are cumulative per upper bound.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.sum, name, h.count)
+}
+
+// metrics of a Balancer, guarded by Balancer.mux.
+type metrics struct {
+	inFlight  int
+	queueWait *histogram
+	latency   *histogram
+	totals    map[int]*ClientStats // by client Id, kept after the client leaves so the counters never go back
+}
+
+func newMetrics() metrics {
+	return metrics{
+		queueWait: newHistogram(defaultBuckets),
+		latency:   newHistogram(defaultBuckets),
+		totals:    map[int]*ClientStats{},
+	}
+}
+
+func (m *metrics) total(id int) *ClientStats {
+	stats, ok := m.totals[id]
+	if !ok {
+		stats = &ClientStats{}
+		m.totals[id] = stats
+	}
+	return stats
+}
+
+// ClientStatus describes a registered client.
+type ClientStatus struct {
+	Id     int    `json:"id"`
+	Key    uint64 `json:"key"`
+	Weight int    `json:"weight"`
+	// InFlight chunks of the client are being processed, CurrentShare is their part of all chunks in flight.
+	InFlight     int     `json:"inFlight"`
+	CurrentShare float64 `json:"currentShare"`
+	// Waiting chunks of the client were taken from its workload and wait for a slot, retries included.
+	Waiting int `json:"waiting"`
+	// WeightShare is the part of the server the client is entitled to by its weight among the registered clients.
+	WeightShare float64 `json:"weightShare"`
+	// Throttled is why the chunk of the client waited at the last pick despite a free slot, empty if it didn't.
+	Throttled Reason      `json:"throttled,omitempty"`
+	Stats     ClientStats `json:"stats"`
+}
+
+// Status is a snapshot of what the Balancer is doing.
+type Status struct {
+	MaxParallel int32           `json:"maxParallel"`
+	Limit       int             `json:"limit"`             // of the Limiter and the Pool now, MaxParallel without them
+	Leased      int             `json:"leased,omitempty"`  // slots leased from the shared Budget
+	Breaker     string          `json:"breaker,omitempty"` // state of the Breaker of a protected server
+	InFlight    int             `json:"inFlight"`
+	Utilisation float64         `json:"utilisation"` // InFlight relative to MaxParallel, not to Limit
+	Clients     []ClientStatus  `json:"clients"`
+	Backends    []BackendStatus `json:"backends,omitempty"` // of a Pool
+}
+
+// Status returns the registered clients with their weights and shares.
+func (b *Balancer[T, R]) Status() Status {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	status := Status{
+		MaxParallel: b.maxParallel,
+		Limit:       b.limit(),
+		InFlight:    b.metrics.inFlight,
+		Utilisation: float64(b.metrics.inFlight) / float64(b.maxParallel),
+		Clients:     make([]ClientStatus, 0, len(b.clients)),
+	}
+	if b.budget != nil {
+		status.Leased = b.budget.Slots()
+	}
+	if b.breaker != nil {
+		status.Breaker = b.breaker.State().String()
+	}
+	if b.pool != nil {
+		status.Backends = b.pool.Backends()
+	}
+	totalWeight := b.totalWeight()
+	for _, cw := range b.clients {
+		cs := ClientStatus{
+			Id:          cw.client.Id(),
+			Key:         cw.key,
+			Weight:      cw.client.Weight(),
+			InFlight:    cw.inFlight,
+			Waiting:     len(cw.retries),
+			WeightShare: float64(cw.client.Weight()) / float64(totalWeight),
+			Throttled:   cw.throttled,
+			Stats:       cw.stats,
+		}
+		if cw.ready {
+			cs.Waiting++
+		}
+		if b.metrics.inFlight > 0 {
+			cs.CurrentShare = float64(cw.inFlight) / float64(b.metrics.inFlight)
+		}
+		status.Clients = append(status.Clients, cs)
+	}
+	return status
+}
+
+// StatusHandler serves Status as JSON.
+func (b *Balancer[T, R]) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(b.Status())
+	})
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+func (b *Balancer[T, R]) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		b.writeMetrics(w)
+	})
+}
+
+func (b *Balancer[T, R]) writeMetrics(w io.Writer) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, v)
+	}
+	gauge("balancer_max_parallel", "Hard limit of chunks processed in parallel.", float64(b.maxParallel))
+	gauge("balancer_limit", "Current limit of chunks processed in parallel, adapted to the server.", float64(b.limit()))
+	if b.budget != nil {
+		gauge("balancer_leased", "Slots leased from the budget shared with other replicas.", float64(b.budget.Slots()))
+	}
+	if b.breaker != nil {
+		gauge("balancer_breaker_state", "State of the circuit breaker: 0 closed, 1 open, 2 half-open.", float64(b.breaker.State()))
+	}
+	gauge("balancer_in_flight", "Chunks being processed.", float64(b.metrics.inFlight))
+	gauge("balancer_utilisation", "Chunks being processed relative to maxParallel.", float64(b.metrics.inFlight)/float64(b.maxParallel))
+	gauge("balancer_clients", "Registered clients.", float64(len(b.clients)))
+	if b.pool != nil {
+		fmt.Fprint(w, "# HELP balancer_backend_in_flight Chunks being processed by a backend of the pool.\n# TYPE balancer_backend_in_flight gauge\n")
+		for _, be := range b.pool.Backends() {
+			fmt.Fprintf(w, "balancer_backend_in_flight{backend=%q} %d\n", be.Name, be.Outstanding)
+		}
+	}
+
+	inFlight := map[int]int{}
+	for _, cw := range b.clients {
+		inFlight[cw.client.Id()] += cw.inFlight
+	}
+	ids := make([]int, 0, len(b.metrics.totals))
+	for id := range b.metrics.totals {
+		ids = append(ids, id)
+	}
+	for id := range inFlight {
+		if _, ok := b.metrics.totals[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	fmt.Fprint(w, "# HELP balancer_client_in_flight Chunks of a client being processed.\n# TYPE balancer_client_in_flight gauge\n")
+	for _, id := range ids {
+		if n, ok := inFlight[id]; ok {
+			fmt.Fprintf(w, "balancer_client_in_flight{client=\"%d\"} %d\n", id, n)
+		}
+	}
+	fmt.Fprint(w, "# HELP balancer_chunks_total Chunks processed for a client by their final result.\n# TYPE balancer_chunks_total counter\n")
+	for _, id := range ids {
+		stats := b.metrics.total(id)
+		fmt.Fprintf(w, "balancer_chunks_total{client=\"%d\",result=\"success\"} %d\n", id, stats.Succeeded)
+		fmt.Fprintf(w, "balancer_chunks_total{client=\"%d\",result=\"failure\"} %d\n", id, stats.Failed)
+		fmt.Fprintf(w, "balancer_chunks_total{client=\"%d\",result=\"rejected\"} %d\n", id, stats.Rejected)
+	}
+	fmt.Fprint(w, "# HELP balancer_retries_total Failed chunks processed again.\n# TYPE balancer_retries_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "balancer_retries_total{client=\"%d\"} %d\n", id, b.metrics.total(id).Retries)
+	}
+
+	fmt.Fprint(w, "# HELP balancer_expired_total Chunks failed because their context was done.\n# TYPE balancer_expired_total counter\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "balancer_expired_total{client=\"%d\"} %d\n", id, b.metrics.total(id).Expired)
+	}
+
+	b.metrics.queueWait.write(w, "balancer_queue_wait_seconds", "Time a chunk waited for a slot.")
+	b.metrics.latency.write(w, "balancer_chunk_duration_seconds", "Time the server took to process a chunk.")
+}
@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it's true or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	b := New[int, int](server, 4)
+	defer b.Close(context.Background())
+	defer close(server.gate)
+
+	b.Register(context.Background(), &testClient{id: 1, weight: 1, n: -1})
+	b.Register(context.Background(), &testClient{id: 2, weight: 3, n: -1})
+	waitFor(t, "all slots busy", func() bool { return atomic.LoadInt32(&server.inFlight) == 4 })
+	waitFor(t, "a chunk of each client waiting", func() bool {
+		clients := b.Status().Clients
+		return clients[0].Waiting == 1 && clients[1].Waiting == 1
+	})
+
+	ts := httptest.NewServer(b.StatusHandler())
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.MaxParallel != 4 || status.InFlight != 4 || status.Utilisation != 1 || len(status.Clients) != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	inFlight := 0
+	for i, expected := range []float64{0.25, 0.75} {
+		c := status.Clients[i]
+		if c.WeightShare != expected || c.CurrentShare != float64(c.InFlight)/4 || c.Waiting != 1 {
+			t.Errorf("unexpected status of client %d: %+v", c.Id, c)
+		}
+		inFlight += c.InFlight
+	}
+	if inFlight != 4 {
+		t.Errorf("clients have %d chunks in flight", inFlight)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := &testServer{delay: 2 * time.Millisecond, fail: func(workChunk int) error {
+		if workChunk < 2 {
+			return errTest
+		}
+		return nil
+	}}
+	b := New[int, int](server, 3)
+	defer b.Close(context.Background())
+	r, _ := b.Register(context.Background(), &testClient{id: 7, weight: 1, n: 10})
+	r.Wait()
+
+	ts := httptest.NewServer(b.MetricsHandler())
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, line := range []string{
+		"balancer_max_parallel 3",
+		"balancer_in_flight 0",
+		"balancer_clients 0",
+		`balancer_chunks_total{client="7",result="success"} 8`,
+		`balancer_chunks_total{client="7",result="failure"} 2`,
+		`balancer_queue_wait_seconds_count 10`,
+		`balancer_chunk_duration_seconds_bucket{le="+Inf"} 10`,
+		`balancer_chunk_duration_seconds_count 10`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics miss %q:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package balancer
+
+import (
+	"math/rand"
+)
+
+// Candidate is a registered client that can be given the next free slot of the Server.
+type Candidate struct {
+	// Key identifies the registration, the same client registered twice has two keys.
+	Key    uint64
+	Id     int
+	Weight int
+	// InFlight chunks of the client are being processed. Share is the number of chunks the client is entitled to
+	// process in parallel, the limit split among all registered clients by their weights.
+	InFlight int
+	Share    float64
+}
+
+// Policy decides which client is served next. The Balancer calls it from one goroutine only.
+type Policy interface {
+	// Pick returns the index of the candidate that gets the next slot. candidates are never empty
+	// and are ordered by the time of registration.
+	Pick(candidates []Candidate) int
+	// Remove forgets the state kept for a client that is no longer registered.
+	Remove(key uint64)
+}
+
+// Option configures a Balancer in New.
+type Option func(*config)
+
+// config of a Balancer that doesn't depend on the types of its chunks.
+type config struct {
+	policy  Policy
+	retry   RetryPolicy
+	limiter Limiter // nil for a fixed limit of maxParallel
+	budget  Budget  // nil for a Balancer that doesn't share the server
+}
+
+// WithPolicy sets the scheduling policy, the default is NewSlotShare().
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// Random implements "Weighted random selection": if client A has weight of 1 and client B has weight of 3 then B
+// is 3x more likely to be picked. Weights are only honoured on average.
+type Random struct {
+	rand *rand.Rand
+}
+
+// NewRandom creates a Random policy drawing from r, nil for the global source.
+func NewRandom(r *rand.Rand) *Random {
+	return &Random{rand: r}
+}
+
+func (p *Random) Pick(candidates []Candidate) int {
+	totalWeight := 0
+	for _, c := range candidates {
+		totalWeight += c.Weight
+	}
+
+	var randValue int
+	if p.rand != nil {
+		randValue = p.rand.Intn(totalWeight)
+	} else {
+		randValue = rand.Intn(totalWeight)
+	}
+
+	for index, c := range candidates {
+		if randValue < c.Weight {
+			return index
+		}
+		randValue -= c.Weight
+	}
+
+	return 0 // not reachable
+}
+
+func (p *Random) Remove(uint64) {}
+
+// WFQ is deterministic weighted fair queueing. Every client has a virtual finish time that grows by 1/weight with
+// every chunk it's given, the client with the earliest finish time is served next. Over any window of picks each
+// client's share differs from its weighted share by at most one chunk.
+type WFQ struct {
+	virtualTime float64
+	finish      map[uint64]float64
+	backlogged  map[uint64]bool // the candidates of the previous pick
+}
+
+func NewWFQ() *WFQ {
+	return &WFQ{finish: map[uint64]float64{}, backlogged: map[uint64]bool{}}
+}
+
+func (p *WFQ) Pick(candidates []Candidate) int {
+	best := -1
+	var bestStart, bestFinish float64
+	backlogged := make(map[uint64]bool, len(candidates))
+	for i, c := range candidates {
+		start := p.finish[c.Key]
+		if !p.backlogged[c.Key] && start < p.virtualTime {
+			// a client that was idle starts at the current virtual time, it can't claim the share it didn't use, even
+			// when it isn't picked now
+			start = p.virtualTime
+			p.finish[c.Key] = start
+		}
+		finish := start + 1/float64(c.Weight)
+		if best < 0 || finish < bestFinish {
+			best, bestStart, bestFinish = i, start, finish
+		}
+		backlogged[c.Key] = true
+	}
+	p.virtualTime = bestStart
+	p.finish[candidates[best].Key] = bestFinish
+	p.backlogged = backlogged
+	return best
+}
+
+func (p *WFQ) Remove(key uint64) {
+	delete(p.finish, key)
+	delete(p.backlogged, key)
+}
+
+// StrictPriority always serves the client with the highest weight, the first registered one among equals. To guard
+// against starvation a client that was passed over MaxSkip times in a row is served next, 0 disables the guard.
+type StrictPriority struct {
+	MaxSkip int
+	skipped map[uint64]int
+}
+
+func NewStrictPriority(maxSkip int) *StrictPriority {
+	return &StrictPriority{MaxSkip: maxSkip, skipped: map[uint64]int{}}
+}
+
+func (p *StrictPriority) Pick(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if c.Weight > candidates[best].Weight {
+			best = i
+		}
+	}
+	if p.MaxSkip > 0 {
+		starving := -1
+		for i, c := range candidates {
+			if p.skipped[c.Key] >= p.MaxSkip && (starving < 0 || p.skipped[c.Key] > p.skipped[candidates[starving].Key]) {
+				starving = i
+			}
+		}
+		if starving >= 0 {
+			best = starving
+		}
+	}
+
+	for i, c := range candidates {
+		if i == best {
+			delete(p.skipped, c.Key)
+		} else {
+			p.skipped[c.Key]++
+		}
+	}
+	return best
+}
+
+func (p *StrictPriority) Remove(key uint64) {
+	delete(p.skipped, key)
+}
+
+// RoundRobin serves the clients in turns regardless of their weights.
+type RoundRobin struct {
+	last    uint64
+	started bool
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (p *RoundRobin) Pick(candidates []Candidate) int {
+	next := 0 // wrap around to the first registered client
+	if p.started {
+		for i, c := range candidates {
+			if c.Key > p.last {
+				next = i
+				break
+			}
+		}
+	}
+	p.last, p.started = candidates[next].Key, true
+	return next
+}
+
+func (p *RoundRobin) Remove(uint64) {}
+
+// SlotShare gives every registered client its weighted share of the slots of the server: the next free slot goes to
+// the ready client that is furthest below its share. A share the client doesn't use because it has no work ready is
+// lent to the others, and as their chunks finish the freed slots return to the client as soon as it has work again.
+type SlotShare struct{}
+
+func NewSlotShare() *SlotShare {
+	return &SlotShare{}
+}
+
+func (p *SlotShare) Pick(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if c.Share-float64(c.InFlight) > candidates[best].Share-float64(candidates[best].InFlight) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *SlotShare) Remove(uint64) {}
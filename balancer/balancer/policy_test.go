@@ -0,0 +1,135 @@
+package balancer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func candidates(weights ...int) []Candidate {
+	cs := make([]Candidate, len(weights))
+	for i, w := range weights {
+		cs[i] = Candidate{Key: uint64(i + 1), Id: i, Weight: w}
+	}
+	return cs
+}
+
+// picks runs n picks of p and returns how many times each candidate was picked after every pick.
+func picks(p Policy, cs []Candidate, n int) [][]int {
+	counts := make([]int, len(cs))
+	history := make([][]int, n)
+	for i := 0; i < n; i++ {
+		counts[p.Pick(cs)]++
+		history[i] = append([]int(nil), counts...)
+	}
+	return history
+}
+
+func TestWFQShares(t *testing.T) {
+	cs := candidates(1, 1, 2, 4)
+	history := picks(NewWFQ(), cs, 800)
+	for n, counts := range history {
+		for i, c := range cs {
+			expected := float64(n+1) * float64(c.Weight) / 8
+			if math.Abs(float64(counts[i])-expected) > 1 {
+				t.Fatalf("after %d picks client %d has %d chunks, expected %.2f", n+1, i, counts[i], expected)
+			}
+		}
+	}
+	if last := history[len(history)-1]; last[0] != 100 || last[1] != 100 || last[2] != 200 || last[3] != 400 {
+		t.Errorf("unexpected shares %v", last)
+	}
+}
+
+func TestWFQIdleClient(t *testing.T) {
+	p := NewWFQ()
+	picks(p, candidates(1, 1), 100)
+	// the third client joins late and must not get the 50 chunks it would have had so far
+	history := picks(p, candidates(1, 1, 1), 30)
+	if last := history[len(history)-1]; last[0] != 10 || last[1] != 10 || last[2] != 10 {
+		t.Errorf("unexpected shares after a client joined %v", last)
+	}
+
+	// nor when it isn't served on the pick it joins at
+	p = NewWFQ()
+	picks(p, candidates(3), 99)
+	history = picks(p, candidates(3, 1), 40)
+	if last := history[len(history)-1]; last[0] != 30 || last[1] != 10 {
+		t.Errorf("unexpected shares after a client joined %v", last)
+	}
+}
+
+func TestStrictPriority(t *testing.T) {
+	cs := candidates(1, 3, 2)
+	history := picks(NewStrictPriority(0), cs, 50)
+	if last := history[len(history)-1]; last[1] != 50 {
+		t.Errorf("the highest priority wasn't always served: %v", last)
+	}
+
+	p := NewStrictPriority(4)
+	history = picks(p, cs, 60)
+	last := history[len(history)-1]
+	if last[0] == 0 || last[2] == 0 {
+		t.Fatalf("low priorities starve: %v", last)
+	}
+	if last[1] <= last[0]+last[2] {
+		t.Errorf("the highest priority isn't preferred: %v", last)
+	}
+	// nobody waits more than MaxSkip picks
+	waited := make([]int, len(cs))
+	for n := 1; n < len(history); n++ {
+		for i := range cs {
+			if history[n][i] == history[n-1][i] {
+				waited[i]++
+			} else {
+				waited[i] = 0
+			}
+			if waited[i] > p.MaxSkip {
+				t.Fatalf("client %d waited %d picks", i, waited[i])
+			}
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	p := NewRoundRobin()
+	cs := candidates(1, 5, 2)
+	for n := 0; n < 9; n++ {
+		if i := p.Pick(cs); i != n%3 {
+			t.Fatalf("pick %d: got %d", n, i)
+		}
+	}
+	// the client served last leaves, the turn goes on with the next one
+	p.Remove(cs[2].Key)
+	if i := p.Pick(cs[:2]); i != 0 {
+		t.Errorf("got %d after removing the last client", i)
+	}
+}
+
+func TestRandomShares(t *testing.T) {
+	cs := candidates(1, 3)
+	history := picks(NewRandom(rand.New(rand.NewSource(1))), cs, 10000)
+	last := history[len(history)-1]
+	if share := float64(last[1]) / 10000; math.Abs(share-0.75) > 0.02 {
+		t.Errorf("share of weight 3 out of 4 is %.3f", share)
+	}
+}
+
+func TestSlotShare(t *testing.T) {
+	p := NewSlotShare()
+	cs := candidates(1, 1, 2)
+	for i := range cs {
+		cs[i].Share = 100 * float64(cs[i].Weight) / 4
+	}
+	for n := 0; n < 100; n++ {
+		cs[p.Pick(cs)].InFlight++
+	}
+	if cs[0].InFlight != 25 || cs[1].InFlight != 25 || cs[2].InFlight != 50 {
+		t.Fatalf("unexpected slots %v %v %v", cs[0].InFlight, cs[1].InFlight, cs[2].InFlight)
+	}
+
+	// a client without work ready lends its share to the others
+	if i := p.Pick(cs[:2]); i != 0 {
+		t.Errorf("got %d with equal deficits", i)
+	}
+}
@@ -0,0 +1,231 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// ErrNoBackends is returned by a Pool without backends.
+var ErrNoBackends = errors.New("no backends")
+
+// Load of a backend of a Pool that has a free slot.
+type Load struct {
+	Name        string
+	Outstanding int // chunks being processed
+	Limit       int
+}
+
+// Router decides which backend of a Pool processes the next chunk. The Pool calls it with its lock held.
+type Router interface {
+	// Route returns the index of the backend that gets the chunk. loads are never empty and are ordered by the time
+	// the backends were added.
+	Route(loads []Load) int
+}
+
+// LeastOutstanding routes a chunk to the backend with the fewest outstanding chunks relative to its limit, the first
+// added one among equals.
+type LeastOutstanding struct{}
+
+func (LeastOutstanding) Route(loads []Load) int {
+	best := 0
+	for i, l := range loads {
+		// l.Outstanding / l.Limit < best.Outstanding / best.Limit without dividing
+		if l.Outstanding*loads[best].Limit < loads[best].Outstanding*l.Limit {
+			best = i
+		}
+	}
+	return best
+}
+
+// PowerOfTwo routes a chunk to the less loaded of two backends drawn at random, relative to their limits. It's
+// almost as good as LeastOutstanding while it doesn't send every chunk to the same backend between two updates of the
+// loads, which matters when the loads are stale.
+type PowerOfTwo struct {
+	rand *rand.Rand
+}
+
+// NewPowerOfTwo creates a PowerOfTwo router drawing from r, nil for the global source.
+func NewPowerOfTwo(r *rand.Rand) *PowerOfTwo {
+	return &PowerOfTwo{rand: r}
+}
+
+func (p *PowerOfTwo) Route(loads []Load) int {
+	if len(loads) == 1 {
+		return 0
+	}
+	intn := rand.Intn
+	if p.rand != nil {
+		intn = p.rand.Intn
+	}
+	a := intn(len(loads))
+	b := intn(len(loads) - 1)
+	if b >= a {
+		b++ // two different backends
+	}
+	if loads[b].Outstanding*loads[a].Limit < loads[a].Outstanding*loads[b].Limit {
+		return b
+	}
+	return a
+}
+
+// BackendStatus describes a backend of a Pool.
+type BackendStatus struct {
+	Name        string `json:"name"`
+	Limit       int    `json:"limit"`
+	Outstanding int    `json:"outstanding"`
+	Processed   int    `json:"processed"`
+	Failed      int    `json:"failed"`
+}
+
+// Pool is a Server that routes every chunk to one of its backends, each of them with its own hard limit of chunks
+// processed in parallel. Backends can be added and removed while it's used.
+//
+// A Balancer of a Pool processes at most the sum of the limits of its backends in parallel, and at most maxParallel:
+// it has maxParallel workers only. The weights of its clients apply to the whole pool.
+type Pool[T, R any] struct {
+	router Router
+
+	mu       sync.Mutex
+	cond     *sync.Cond // signalled when a backend got a free slot
+	backends []*backend[T, R]
+	notify   func()
+}
+
+type backend[T, R any] struct {
+	server Server[T, R]
+	BackendStatus
+}
+
+// NewPool creates an empty Pool routing the chunks by router.
+func NewPool[T, R any](router Router) *Pool[T, R] {
+	p := &Pool[T, R]{router: router}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Add a backend processing at most limit chunks in parallel. The name must be unique in the pool.
+func (p *Pool[T, R]) Add(name string, server Server[T, R], limit int) error {
+	if limit < 1 {
+		return fmt.Errorf("limit of the backend %s must be positive", name)
+	}
+	p.mu.Lock()
+	for _, be := range p.backends {
+		if be.Name == name {
+			p.mu.Unlock()
+			return fmt.Errorf("backend %s already added", name)
+		}
+	}
+	p.backends = append(p.backends, &backend[T, R]{server: server, BackendStatus: BackendStatus{Name: name, Limit: limit}})
+	notify := p.notify
+	p.mu.Unlock()
+	p.cond.Broadcast()
+	if notify != nil {
+		notify()
+	}
+	return nil
+}
+
+// Remove the backend name, false if there's none. The chunks it's processing are finished.
+func (p *Pool[T, R]) Remove(name string) bool {
+	p.mu.Lock()
+	removed := false
+	for i, be := range p.backends {
+		if be.Name == name {
+			p.backends = append(p.backends[:i], p.backends[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	p.mu.Unlock()
+	// the chunks waiting for a backend may have none now
+	p.cond.Broadcast()
+	return removed
+}
+
+// Capacity returns the sum of the limits of the backends.
+func (p *Pool[T, R]) Capacity() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	capacity := 0
+	for _, be := range p.backends {
+		capacity += be.Limit
+	}
+	return capacity
+}
+
+// Backends returns the backends in the order they were added.
+func (p *Pool[T, R]) Backends() []BackendStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	backends := make([]BackendStatus, len(p.backends))
+	for i, be := range p.backends {
+		backends[i] = be.BackendStatus
+	}
+	return backends
+}
+
+// Process routes workChunk to a backend with a free slot, waiting for one if all of them are busy. It fails with
+// ErrNoBackends if the pool is empty and with the error of ctx if it's done while waiting.
+func (p *Pool[T, R]) Process(ctx context.Context, workChunk T) (R, error) {
+	var zero R
+	// a chunk waiting for a free slot gives up once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	})
+	p.mu.Lock()
+	var free []*backend[T, R]
+	for {
+		if len(p.backends) == 0 {
+			p.mu.Unlock()
+			stop()
+			return zero, ErrNoBackends
+		}
+		free = free[:0]
+		for _, be := range p.backends {
+			if be.Outstanding < be.Limit {
+				free = append(free, be)
+			}
+		}
+		if len(free) > 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			p.mu.Unlock()
+			stop()
+			return zero, err
+		}
+		p.cond.Wait()
+	}
+	stop()
+	loads := make([]Load, len(free))
+	for i, be := range free {
+		loads[i] = Load{Name: be.Name, Outstanding: be.Outstanding, Limit: be.Limit}
+	}
+	be := free[p.router.Route(loads)]
+	be.Outstanding++
+	p.mu.Unlock()
+
+	value, err := be.server.Process(ctx, workChunk)
+
+	p.mu.Lock()
+	be.Outstanding--
+	be.Processed++
+	if err != nil {
+		be.Failed++
+	}
+	p.mu.Unlock()
+	p.cond.Broadcast()
+	return value, err
+}
+
+// setNotify sets the function called when a backend was added.
+func (p *Pool[T, R]) setNotify(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.notify = f
+}
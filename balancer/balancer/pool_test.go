@@ -0,0 +1,106 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRouters(t *testing.T) {
+	loads := []Load{{Name: "a", Outstanding: 2, Limit: 4}, {Name: "b", Outstanding: 1, Limit: 4}, {Name: "c", Outstanding: 2, Limit: 8}}
+	if i := (LeastOutstanding{}).Route(loads); i != 1 {
+		t.Errorf("least outstanding routed to %s", loads[i].Name)
+	}
+
+	// the most loaded backend loses every draw
+	counts := make([]int, len(loads))
+	p := NewPowerOfTwo(rand.New(rand.NewSource(1)))
+	for i := 0; i < 300; i++ {
+		counts[p.Route(loads)]++
+	}
+	if counts[0] != 0 || counts[1] < 150 || counts[2] < 50 {
+		t.Errorf("power of two routed %v", counts)
+	}
+}
+
+func TestPool(t *testing.T) {
+	servers := map[string]*testServer{}
+	pool := NewPool[int, int](LeastOutstanding{})
+	add := func(name string, limit int) {
+		servers[name] = &testServer{gate: make(chan struct{})}
+		if err := pool.Add(name, servers[name], limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := New(pool, 10)
+	defer b.Close(context.Background())
+
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 200})
+	add("a", 2)
+	add("b", 3)
+	waitFor(t, "both backends busy", func() bool { return b.Status().InFlight == 5 })
+	if err := pool.Add("a", &testServer{}, 1); err == nil {
+		t.Error("added a backend twice")
+	}
+	add("c", 4)
+	waitFor(t, "all backends busy", func() bool { return b.Status().InFlight == 9 })
+	if status := b.Status(); status.Limit != 9 || len(status.Backends) != 3 || status.Backends[2].Outstanding != 4 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// the chunks of a removed backend are finished, the others are processed by the rest
+	pool.Remove("c")
+	close(servers["c"].gate)
+	close(servers["a"].gate)
+	close(servers["b"].gate)
+	r.Wait()
+	for name, limit := range map[string]int32{"a": 2, "b": 3, "c": 4} {
+		if peak := atomic.LoadInt32(&servers[name].peak); peak != limit {
+			t.Errorf("%d chunks processed by %s in parallel", peak, name)
+		}
+	}
+	if c := atomic.LoadInt32(&servers["c"].processed); c != 4 {
+		t.Errorf("%d chunks processed by the removed backend", c)
+	}
+	if stats := r.Stats(); stats.Succeeded != 200 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEmptyPool(t *testing.T) {
+	pool := NewPool[int, int](NewPowerOfTwo(nil))
+	if _, err := pool.Process(context.Background(), 1); !errors.Is(err, ErrNoBackends) {
+		t.Errorf("expected no backends, got %v", err)
+	}
+	if err := pool.Add("a", &testServer{}, 0); err == nil {
+		t.Error("added a backend without slots")
+	}
+}
+
+func TestPoolWaitCancelled(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	pool := NewPool[int, int](LeastOutstanding{})
+	pool.Add("a", server, 1)
+	go pool.Process(context.Background(), 1)
+	waitFor(t, "the backend busy", func() bool { return atomic.LoadInt32(&server.inFlight) == 1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := pool.Process(ctx, 2)
+		errs <- err
+	}()
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the error of the context, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the chunk still waits for a backend")
+	}
+	close(server.gate)
+}
@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"time"
+)
+
+// Result of one work chunk of a client, reported once the chunk succeeded or failed for the last time.
+type Result[T, R any] struct {
+	Chunk    T
+	Value    R // returned by the Server with the error of the last attempt
+	Err      error
+	Attempts int // how many times the chunk was processed, 0 if it was dropped before processing
+}
+
+// ClientStats counts the chunks of one registration.
+type ClientStats struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"` // chunks that failed for the last time
+	Errors    int `json:"errors"` // failed attempts, including those that were retried
+	Retries   int `json:"retries"`
+	Rejected  int `json:"rejected"` // chunks over the quota, not counted as failed
+	// Expired chunks failed because their context was done, by WithChunkTimeout or the context of Register, before
+	// or while they were processed. They are counted as failed too.
+	Expired int `json:"expired"`
+}
+
+// RetryPolicy decides whether and when a failed chunk is processed again. A retried chunk waits for its backoff
+// without taking a slot and then takes a slot like any other chunk, so retries never exceed maxParallel.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts of a chunk including the first one, 0 or 1 for no retries
+	Backoff     time.Duration // wait before the first retry
+	MaxBackoff  time.Duration // the wait doubles with every retry up to MaxBackoff, 0 for no limit
+	// Retryable reports whether a chunk that failed with err can succeed when processed again, nil for all errors.
+	Retryable func(err error) bool
+}
+
+// WithRetry sets the retry policy for failed chunks, by default they are not retried.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = p
+	}
+}
+
+func (p RetryPolicy) shouldRetry(attempts int, err error) bool {
+	return attempts < p.MaxAttempts && (p.Retryable == nil || p.Retryable(err))
+}
+
+// backoff returns the wait before the attempt that follows attempts failed ones.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// RegisterOption configures a registration in Balancer.Register.
+type RegisterOption func(*registerConfig)
+
+type registerConfig struct {
+	onResult any // func(Result[T, R]) of the Balancer's types, checked by Register
+	usage    *usage
+	timeout  time.Duration
+}
+
+// OnResult calls f with the result of every chunk of the client. f is called from the workers, it must not block.
+// Register fails if T and R are not the types of the Balancer.
+func OnResult[T, R any](f func(Result[T, R])) RegisterOption {
+	return func(rc *registerConfig) {
+		rc.onResult = f
+	}
+}
+
+// WithChunkTimeout gives every chunk of the client d from the moment it's taken from its workload until it's
+// processed, retries included. A chunk that runs out of time while it waits for a slot is dropped, one being
+// processed has its context cancelled, either fails with the error of its context.
+func WithChunkTimeout(d time.Duration) RegisterOption {
+	return func(rc *registerConfig) {
+		rc.timeout = d
+	}
+}
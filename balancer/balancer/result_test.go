@@ -0,0 +1,185 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test failure")
+
+// collect returns a RegisterOption that records the results and a function returning them.
+func collect() (RegisterOption, func() []Result[int, int]) {
+	var mu sync.Mutex
+	var results []Result[int, int]
+	return OnResult(func(r Result[int, int]) {
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}), func() []Result[int, int] {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]Result[int, int](nil), results...)
+		}
+}
+
+func TestResults(t *testing.T) {
+	server := &testServer{fail: func(workChunk int) error {
+		if workChunk%3 == 0 {
+			return errTest
+		}
+		return nil
+	}}
+	b := New[int, int](server, 4)
+	defer b.Close(context.Background())
+
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 30}, onResult)
+	r.Wait()
+
+	if stats := r.Stats(); stats != (ClientStats{Succeeded: 20, Failed: 10, Errors: 10}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	seen := map[int]bool{}
+	for _, result := range results() {
+		seen[result.Chunk] = true
+		if (result.Chunk%3 == 0) != errors.Is(result.Err, errTest) || result.Attempts != 1 || result.Value != 2*result.Chunk {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	if len(seen) != 30 {
+		t.Errorf("results of %d chunks", len(seen))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	server := &testServer{fail: func(workChunk int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts[workChunk]++; attempts[workChunk] <= 2 {
+			return errTest
+		}
+		return nil
+	}}
+	b := New[int, int](server, 3, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	defer b.Close(context.Background())
+
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 20}, onResult)
+	r.Wait()
+
+	if stats := r.Stats(); stats != (ClientStats{Succeeded: 20, Errors: 40, Retries: 40}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	for _, result := range results() {
+		if result.Err != nil || result.Attempts != 3 {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	if peak := atomic.LoadInt32(&server.peak); peak > 3 {
+		t.Errorf("%d chunks processed in parallel", peak)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server := &testServer{fail: func(int) error { return errTest }}
+	permanent := errors.New("permanent")
+	b := New[int, int](server, 2, WithRetry(RetryPolicy{
+		MaxAttempts: 4,
+		Backoff:     time.Millisecond,
+		Retryable:   func(err error) bool { return !errors.Is(err, permanent) },
+	}))
+	defer b.Close(context.Background())
+
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 5})
+	r.Wait()
+	if stats := r.Stats(); stats != (ClientStats{Failed: 5, Errors: 20, Retries: 15}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	server.fail = func(int) error { return permanent }
+	r, _ = b.Register(context.Background(), &testClient{id: 2, weight: 1, n: 5})
+	r.Wait()
+	if stats := r.Stats(); stats != (ClientStats{Failed: 5, Errors: 5}) {
+		t.Errorf("permanent errors retried: %+v", stats)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempts, expected := range []time.Duration{0: 10, 1: 10, 2: 20, 3: 40, 4: 50, 5: 50} {
+		if d := p.backoff(attempts); d != expected*time.Millisecond {
+			t.Errorf("backoff after %d attempts: %v", attempts, d)
+		}
+	}
+}
+
+// slowServer processes the chunks in slow until their context is done and returns its error a bit later, the others
+// right away.
+type slowServer struct {
+	slow      map[int]bool
+	processed []int
+	mu        sync.Mutex
+}
+
+func (s *slowServer) Process(ctx context.Context, workChunk int) (int, error) {
+	s.mu.Lock()
+	s.processed = append(s.processed, workChunk)
+	s.mu.Unlock()
+	if !s.slow[workChunk] {
+		return workChunk, nil
+	}
+	<-ctx.Done()
+	time.Sleep(20 * time.Millisecond)
+	return 0, ctx.Err()
+}
+
+func TestChunkTimeout(t *testing.T) {
+	server := &slowServer{slow: map[int]bool{0: true}}
+	b := New[int, int](server, 1)
+	defer b.Close(context.Background())
+
+	// the first chunk is cancelled while it's processed, the second one expires waiting for it
+	onResult, results := collect()
+	r, _ := b.Register(context.Background(), &testClient{id: 1, weight: 1, n: 4}, onResult, WithChunkTimeout(50*time.Millisecond))
+	r.Wait()
+
+	if stats := r.Stats(); stats != (ClientStats{Succeeded: 2, Failed: 2, Errors: 1, Expired: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	for _, result := range results() {
+		attempts := map[int]int{0: 1, 1: 0, 2: 1, 3: 1}[result.Chunk]
+		if (result.Chunk < 2) != errors.Is(result.Err, context.DeadlineExceeded) || result.Attempts != attempts {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.processed) != 3 || server.processed[1] != 2 {
+		t.Errorf("processed %v", server.processed)
+	}
+}
+
+func TestQueuedChunkExpires(t *testing.T) {
+	server := &testServer{gate: make(chan struct{})}
+	b := New[int, int](server, 1)
+	defer b.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	onResult, results := collect()
+	r, _ := b.Register(ctx, &testClient{id: 1, weight: 1, n: 2}, onResult)
+	waitFor(t, "the first chunk being processed", func() bool { return atomic.LoadInt32(&server.inFlight) == 1 })
+	time.Sleep(10 * time.Millisecond) // the second chunk waits for the slot, nothing else wakes the scheduler
+	cancel()
+	waitFor(t, "the waiting chunk expired", func() bool { return len(results()) == 1 })
+	if result := results()[0]; result.Chunk != 1 || !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	server.gate <- struct{}{}
+	r.Wait()
+}
@@ -0,0 +1,115 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+)
+
+// gatedServer holds every chunk until it's released for its client, the client of a chunk is workChunk / 1000.
+type gatedServer struct {
+	gates map[int]chan struct{}
+}
+
+func (s *gatedServer) Process(_ context.Context, workChunk int) error {
+	<-s.gates[workChunk/1000]
+	return nil
+}
+
+// TestSlotShares plays the scenario of the Balancer doc comment: 100 slots split 25/25/50 by weights 1, 1 and 2,
+// given to the first two 50/50 when the third one leaves and reclaimed by a newcomer slot by slot.
+func TestSlotShares(t *testing.T) {
+	server := &gatedServer{gates: map[int]chan struct{}{}}
+	for id := 1; id <= 4; id++ {
+		server.gates[id] = make(chan struct{})
+	}
+	b := New(WithoutResults[int](server), 100)
+	defer func() {
+		for _, gate := range server.gates {
+			close(gate)
+		}
+		b.Close(context.Background())
+	}()
+
+	// settle waits until the scheduler filled all slots and every registered client has a chunk ready
+	settle := func() {
+		waitFor(t, "all slots busy", func() bool {
+			b.mux.Lock()
+			defer b.mux.Unlock()
+			return b.metrics.inFlight == 100 && len(b.readyClients()) == len(b.clients)
+		})
+	}
+	inFlight := func() map[int]int {
+		counts := map[int]int{}
+		for _, c := range b.Status().Clients {
+			counts[c.Id] = c.InFlight
+		}
+		return counts
+	}
+	succeeded := func(id int) int {
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		return b.metrics.total(id).Succeeded
+	}
+	// release finishes one chunk of the client and waits until its slot is taken again
+	release := func(id int) {
+		done := succeeded(id)
+		server.gates[id] <- struct{}{}
+		waitFor(t, "the chunk to complete", func() bool { return succeeded(id) > done })
+		settle()
+	}
+	// balance releases chunks of the clients above their share until they all have it
+	balance := func(shares map[int]int) {
+		for i := 0; i < 100; i++ {
+			counts := inFlight()
+			over := 0
+			for id, share := range shares {
+				if counts[id] > share && (over == 0 || counts[id]-share > counts[over]-shares[over]) {
+					over = id
+				}
+			}
+			if over == 0 {
+				return
+			}
+			release(over)
+		}
+		t.Fatalf("shares not reached: %v", inFlight())
+	}
+	endless := func(id, weight int) *testClient {
+		return &testClient{id: id, weight: weight, n: -1, base: id * 1000}
+	}
+
+	b.Register(context.Background(), endless(1, 1))
+	b.Register(context.Background(), endless(2, 1))
+	third, _ := b.Register(context.Background(), endless(3, 2))
+	settle()
+	// the clients may have been registered one by one, once the first slots free up the shares are exact
+	balance(map[int]int{1: 25, 2: 25, 3: 50})
+	for i := 0; i < 20; i++ {
+		release(1 + i%3)
+		if counts := inFlight(); counts[1] != 25 || counts[2] != 25 || counts[3] != 50 {
+			t.Fatalf("shares drifted to %v", counts)
+		}
+	}
+
+	// the third client leaves, its slots are lent to the others as its chunks finish
+	third.Deregister()
+	for i := 0; i < 50; i++ {
+		release(3)
+	}
+	if counts := inFlight(); counts[1] != 50 || counts[2] != 50 {
+		t.Fatalf("unexpected slots after a client left: %v", counts)
+	}
+
+	// a newcomer reclaims its share with every slot that frees up
+	b.Register(context.Background(), endless(4, 2))
+	settle()
+	for i := 0; i < 50; i++ {
+		release(1 + i%2)
+		if counts := inFlight(); counts[4] != i+1 {
+			t.Fatalf("the newcomer got %d slots out of %d freed", counts[4], i+1)
+		}
+	}
+	if counts := inFlight(); counts[1] != 25 || counts[2] != 25 || counts[4] != 50 {
+		t.Errorf("unexpected slots after a client joined: %v", counts)
+	}
+}
@@ -0,0 +1,275 @@
+// Package budget shares the hard limit of a server among several replicas of a Balancer. Every replica leases slots
+// from a Backend that never grants more than the limit in total, and processes a chunk only with a leased slot.
+//
+// The slots are split among the replicas by the weights of their clients, like SlotShare splits the slots of one
+// Balancer among its clients: a replica below its share leases free slots, a replica that doesn't need its share
+// lends it to the others, and a replica above its share returns its slots as its chunks finish when another one is
+// below its share.
+//
+// The leases expire unless the replica syncs with the Backend within the TTL, so the slots of a replica that crashed
+// are freed. A replica that can't sync stops processing chunks once its leases expired. The TTL must be longer than
+// a chunk takes, a chunk that outlives the lease of its slot could exceed the limit.
+package budget
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Replica is the state of a replica in a Backend.
+type Replica struct {
+	Id      string
+	Weight  int  // of its registered clients
+	Waiting bool // a chunk waits for a slot
+	Held    int  // leased slots
+}
+
+// Backend keeps the leases of the replicas sharing a budget. Leases of a replica expire ttl after its last Lease or
+// Sync.
+type Backend interface {
+	// Lease takes up to n more slots for the replica if fewer than limit slots are leased in total, it returns how
+	// many slots it took.
+	Lease(ctx context.Context, id string, n, limit int, ttl time.Duration) (int, error)
+	// Return gives back n slots of the replica.
+	Return(ctx context.Context, id string, n int) error
+	// Sync renews the leases of the replica, publishes its weight and whether it's waiting for a slot, and returns
+	// the live replicas including this one.
+	Sync(ctx context.Context, id string, weight int, waiting bool, ttl time.Duration) ([]Replica, error)
+}
+
+// Shared is the part of a budget leased by one replica, it implements balancer.Budget.
+type Shared struct {
+	backend Backend
+	id      string
+	limit   int
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	held    int // leased slots, valid until synced+ttl
+	used    int // slots taken by chunks being processed
+	peak    int // most slots used since the last renewal
+	weight  int
+	waiting bool
+	share   float64
+	others  bool // another replica waits for a slot
+	deficit bool // another replica waits below its share
+	synced  time.Time
+	notify  func()
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts leasing slots of a budget of limit slots from backend for the replica id. The leases are renewed every
+// ttl/3, see Close.
+func New(backend Backend, id string, limit int, ttl time.Duration) *Shared {
+	s := &Shared{
+		backend: backend,
+		id:      id,
+		limit:   limit,
+		ttl:     ttl,
+		notify:  func() {},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Shared) Acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used >= s.slots() {
+		s.poke()
+		return false
+	}
+	s.used++
+	s.peak = max(s.peak, s.used)
+	return true
+}
+
+func (s *Shared) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used--
+	if s.others {
+		s.poke()
+	}
+}
+
+func (s *Shared) Demand(weight int, waiting bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if weight != s.weight || waiting != s.waiting {
+		s.weight, s.waiting = weight, waiting
+		s.poke()
+	}
+}
+
+func (s *Shared) Slots() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slots()
+}
+
+func (s *Shared) Notify(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify = f
+}
+
+// slots returns the leased slots that didn't expire, s.mu must be held.
+func (s *Shared) slots() int {
+	if time.Since(s.synced) >= s.ttl {
+		return 0
+	}
+	return s.held
+}
+
+// poke wakes up run to sync with the backend.
+func (s *Shared) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops leasing and returns the leased slots, it should be called once no chunks are processed. Calling it
+// again does nothing.
+func (s *Shared) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		s.mu.Lock()
+		held := s.held
+		s.held = 0
+		s.mu.Unlock()
+		if err = s.backend.Return(ctx, s.id, held); err != nil {
+			return
+		}
+		_, err = s.backend.Sync(ctx, s.id, 0, false, s.ttl)
+	})
+	return err
+}
+
+func (s *Shared) run() {
+	defer close(s.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	renewal := true
+	for {
+		s.sync(ctx, renewal)
+		select {
+		case <-s.wake:
+			renewal = false
+		case <-ticker.C:
+			renewal = true
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sync renews the leases and returns or leases slots to get the replica to its share. Only run calls it, so the
+// leases don't change in the backend while it runs.
+//
+// A replica above its share returns the slots as they become free while another one is below its share. The slots
+// that were not used at all since the last renewal are lent to the others waiting for slots, a replica that just
+// finished a chunk would return the slot it's about to use otherwise.
+func (s *Shared) sync(ctx context.Context, renewal bool) {
+	s.mu.Lock()
+	weight, waiting := s.weight, s.waiting
+	s.mu.Unlock()
+
+	started := time.Now()
+	replicas, err := s.backend.Sync(ctx, s.id, weight, waiting, s.ttl)
+	if err != nil {
+		return // the leases expire unless a later sync succeeds
+	}
+	total := 0
+	for _, r := range replicas {
+		total += r.Weight
+	}
+	shareOf := func(r Replica) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(s.limit) * float64(r.Weight) / float64(total)
+	}
+	var held int
+	var share float64
+	others, deficit := false, false
+	for _, r := range replicas {
+		if r.Id == s.id {
+			held, share = r.Held, shareOf(r)
+		} else if r.Waiting {
+			others = true
+			deficit = deficit || r.Held < minShare(shareOf(r))
+		}
+	}
+
+	s.mu.Lock()
+	// the backend counts the leases, fewer than expected means some expired before this sync
+	s.held, s.synced, s.share, s.others, s.deficit = held, started, share, others, deficit
+	idle := s.held - s.used
+	back := 0
+	if over := s.held - int(math.Ceil(share)); deficit && over > 0 {
+		back = min(idle, over)
+	}
+	if renewal {
+		if unused := s.held - s.peak; others && unused > back {
+			back = min(idle, unused)
+		}
+		s.peak = s.used
+	}
+	more := 0
+	if back == 0 && s.waiting && s.used >= s.held {
+		// below the share take all that's missing right away, above it only lend slots nobody else needs
+		if more = minShare(share) - s.held; more < 1 {
+			more = 1
+			if deficit {
+				more = 0
+			}
+		}
+	}
+	s.held -= back
+	s.mu.Unlock()
+
+	if back > 0 {
+		// if it fails the backend keeps counting the slots, the next sync gets them back
+		_ = s.backend.Return(ctx, s.id, back)
+	}
+	if more > 0 {
+		n, err := s.backend.Lease(ctx, s.id, more, s.limit, s.ttl)
+		if err != nil || n == 0 {
+			return
+		}
+		s.mu.Lock()
+		s.held += n
+		notify := s.notify
+		s.mu.Unlock()
+		notify()
+	}
+}
+
+// minShare is the number of slots a replica with share may claim from the others, at least one so that a replica
+// with a tiny weight isn't starved.
+func minShare(share float64) int {
+	if share < 1 {
+		return 1
+	}
+	return int(share)
+}
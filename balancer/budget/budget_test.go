@@ -0,0 +1,230 @@
+package budget
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+// waitFor polls cond until it's true or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// clock is a fake time for the backends.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// testBackend checks the leases of b that uses c.
+func testBackend(t *testing.T, b Backend, c *clock) {
+	ctx := context.Background()
+	const ttl = time.Second
+	lease := func(id string, n, expected int) {
+		t.Helper()
+		if got, err := b.Lease(ctx, id, n, 8, ttl); err != nil || got != expected {
+			t.Fatalf("%s leased %d of %d, expected %d: %v", id, got, n, expected, err)
+		}
+	}
+	sync := func(id string, weight int, expected ...Replica) {
+		t.Helper()
+		replicas, err := b.Sync(ctx, id, weight, weight > 0, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byId := map[string]Replica{}
+		for _, r := range replicas {
+			byId[r.Id] = r
+		}
+		if len(byId) != len(expected) {
+			t.Fatalf("replicas %v, expected %v", replicas, expected)
+		}
+		for _, r := range expected {
+			if byId[r.Id] != r {
+				t.Errorf("replica %+v, expected %+v", byId[r.Id], r)
+			}
+		}
+	}
+
+	lease("a", 5, 5)
+	lease("b", 5, 3)
+	lease("b", 1, 0)
+	if err := b.Return(ctx, "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	lease("b", 5, 2)
+	sync("a", 3, Replica{Id: "a", Weight: 3, Waiting: true, Held: 3}, Replica{Id: "b", Held: 5})
+
+	// b doesn't renew its leases, they expire
+	c.Advance(ttl / 2)
+	sync("a", 1, Replica{Id: "a", Weight: 1, Waiting: true, Held: 3}, Replica{Id: "b", Held: 5})
+	c.Advance(ttl/2 + time.Millisecond)
+	sync("a", 1, Replica{Id: "a", Weight: 1, Waiting: true, Held: 3})
+	lease("c", 8, 5)
+}
+
+func TestMemory(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	m := NewMemory()
+	m.now = c.Now
+	testBackend(t, m, c)
+}
+
+// server counts the chunks processed in parallel by all replicas.
+type server struct {
+	inFlight, peak int32
+}
+
+func (s *server) Process(_ context.Context, _ int) error {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&s.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&s.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+// endless feeds chunks until its context is done.
+type endless struct {
+	id, weight int
+}
+
+func (c endless) Weight() int { return c.weight }
+func (c endless) Id() int     { return c.id }
+
+func (c endless) Workload(ctx context.Context) chan int {
+	workload := make(chan int)
+	go func() {
+		defer close(workload)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case workload <- 1:
+			}
+		}
+	}()
+	return workload
+}
+
+type replica struct {
+	budget *Shared
+	b      *balancer.Balancer[int, struct{}]
+	client *balancer.Registration[int, struct{}] // nil without a weight
+}
+
+// replicas starts a Balancer for every weight sharing a budget of limit slots in backend, every one of them could
+// process all the slots alone. A replica with a weight has a client with it.
+func replicas(t *testing.T, backend Backend, s *server, limit int, weights ...int) []replica {
+	var rs []replica
+	for i, weight := range weights {
+		budget := New(backend, string(rune('a'+i)), limit, time.Second)
+		b := balancer.New(balancer.WithoutResults[int](s), int32(limit), balancer.WithBudget(budget))
+		r := replica{budget: budget, b: b}
+		if weight > 0 {
+			r.client, _ = b.Register(context.Background(), endless{id: i, weight: weight})
+		}
+		rs = append(rs, r)
+	}
+	t.Cleanup(func() {
+		for _, r := range rs {
+			r.b.Close(context.Background())
+			r.budget.Close(context.Background())
+		}
+	})
+	return rs
+}
+
+func leased(rs []replica) []int {
+	slots := make([]int, len(rs))
+	for i, r := range rs {
+		slots[i] = r.budget.Slots()
+	}
+	return slots
+}
+
+func TestSharedWeights(t *testing.T) {
+	s := &server{}
+	rs := replicas(t, NewMemory(), s, 12, 1, 1, 2)
+	waitFor(t, "shares of 3, 3 and 6 slots", func() bool {
+		slots := leased(rs)
+		return slots[0] == 3 && slots[1] == 3 && slots[2] == 6
+	})
+	time.Sleep(50 * time.Millisecond)
+	if slots := leased(rs); slots[0] != 3 || slots[1] != 3 || slots[2] != 6 {
+		t.Errorf("shares drifted to %v", slots)
+	}
+
+	// the third replica has no more work, the others split its slots
+	rs[2].client.Deregister()
+	waitFor(t, "shares of 6 and 6 slots", func() bool {
+		slots := leased(rs)
+		return slots[0] == 6 && slots[1] == 6
+	})
+	if peak := atomic.LoadInt32(&s.peak); peak > 12 {
+		t.Errorf("%d chunks processed in parallel by all replicas", peak)
+	}
+}
+
+func TestSharedLending(t *testing.T) {
+	s := &server{}
+	rs := replicas(t, NewMemory(), s, 10, 1, 0)
+	waitFor(t, "all slots lent to the busy replica", func() bool { return rs[0].budget.Slots() == 10 })
+
+	rs[1].b.Register(context.Background(), endless{id: 2, weight: 4})
+	waitFor(t, "shares of 2 and 8 slots", func() bool {
+		slots := leased(rs)
+		return slots[0] == 2 && slots[1] == 8
+	})
+	if peak := atomic.LoadInt32(&s.peak); peak > 10 {
+		t.Errorf("%d chunks processed in parallel by all replicas", peak)
+	}
+}
+
+func TestSharedExpiry(t *testing.T) {
+	m := NewMemory()
+	// a replica that crashed holding all slots
+	m.Lease(context.Background(), "crashed", 5, 5, 100*time.Millisecond)
+
+	s := New(m, "alive", 5, 100*time.Millisecond)
+	s.Demand(1, true)
+	if s.Acquire() {
+		t.Fatal("acquired a slot of a full budget")
+	}
+	waitFor(t, "the slots of the crashed replica", func() bool { return s.Slots() == 5 })
+
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Errorf("closed again: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package budget
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a Backend for replicas in one process.
+type Memory struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	replicas map[string]*memoryReplica
+}
+
+type memoryReplica struct {
+	Replica
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{now: time.Now, replicas: map[string]*memoryReplica{}}
+}
+
+// replica returns the live replica id renewed for ttl, m.mu must be held.
+func (m *Memory) replica(id string, ttl time.Duration) *memoryReplica {
+	now := m.now()
+	for other, r := range m.replicas {
+		if !r.expires.After(now) {
+			delete(m.replicas, other)
+		}
+	}
+	r, ok := m.replicas[id]
+	if !ok {
+		r = &memoryReplica{Replica: Replica{Id: id}}
+		m.replicas[id] = r
+	}
+	r.expires = now.Add(ttl)
+	return r
+}
+
+func (m *Memory) Lease(_ context.Context, id string, n, limit int, ttl time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.replica(id, ttl)
+	held := 0
+	for _, other := range m.replicas {
+		held += other.Held
+	}
+	n = max(0, min(n, limit-held))
+	r.Held += n
+	return n, nil
+}
+
+func (m *Memory) Return(_ context.Context, id string, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.replicas[id]; ok {
+		r.Held = max(0, r.Held-n)
+	}
+	return nil
+}
+
+func (m *Memory) Sync(_ context.Context, id string, weight int, waiting bool, ttl time.Duration) ([]Replica, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.replica(id, ttl)
+	r.Weight, r.Waiting = weight, waiting
+
+	replicas := make([]Replica, 0, len(m.replicas))
+	for _, r := range m.replicas {
+		replicas = append(replicas, r.Replica)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Id < replicas[j].Id })
+	return replicas, nil
+}
@@ -0,0 +1,115 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Backend in Redis, or anything speaking its protocol with Lua scripting, for replicas in several
+// processes. Every change is a script, so it's atomic. The expiry is computed from the clocks of the replicas, they
+// should be in sync to well below the TTL.
+//
+// It uses four keys with the prefix: hashes of the leased slots, weights and waiting flags of the replicas by their
+// Id, and a sorted set of the replicas by the time their leases expire. The prefix is their hash tag, so they are in
+// the same slot of a Redis Cluster as its scripts require.
+type Redis struct {
+	client redis.Scripter
+	keys   []string
+	now    func() time.Time
+}
+
+// NewRedis creates a Redis backend with keys starting with the hash tag of prefix, e.g. "{balancer:budget:}held" for
+// "balancer:budget:".
+func NewRedis(client redis.Scripter, prefix string) *Redis {
+	tag := "{" + prefix + "}"
+	return &Redis{
+		client: client,
+		keys:   []string{tag + "held", tag + "weight", tag + "waiting", tag + "expires"},
+		now:    time.Now,
+	}
+}
+
+// renew removes the expired replicas and renews the replica ARGV[1] until ARGV[3] at ARGV[2] milliseconds.
+const renew = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[2])
+for _, id in ipairs(expired) do
+	redis.call('HDEL', KEYS[1], id)
+	redis.call('HDEL', KEYS[2], id)
+	redis.call('HDEL', KEYS[3], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[4], '-inf', ARGV[2])
+redis.call('ZADD', KEYS[4], ARGV[3], ARGV[1])
+redis.call('HSETNX', KEYS[1], ARGV[1], 0)
+`
+
+var leaseScript = redis.NewScript(renew + `
+local held = 0
+for _, n in ipairs(redis.call('HVALS', KEYS[1])) do
+	held = held + tonumber(n)
+end
+local n = math.max(0, math.min(tonumber(ARGV[4]), tonumber(ARGV[5]) - held))
+redis.call('HINCRBY', KEYS[1], ARGV[1], n)
+return n
+`)
+
+var returnScript = redis.NewScript(`
+local held = redis.call('HGET', KEYS[1], ARGV[1])
+if held then
+	redis.call('HSET', KEYS[1], ARGV[1], math.max(0, tonumber(held) - tonumber(ARGV[2])))
+end
+return 0
+`)
+
+var syncScript = redis.NewScript(renew + `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[4])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[5])
+local replicas = {}
+for _, id in ipairs(redis.call('ZRANGE', KEYS[4], 0, -1)) do
+	table.insert(replicas, id)
+	table.insert(replicas, redis.call('HGET', KEYS[1], id) or '0')
+	table.insert(replicas, redis.call('HGET', KEYS[2], id) or '0')
+	table.insert(replicas, redis.call('HGET', KEYS[3], id) or '0')
+end
+return replicas
+`)
+
+// times returns the arguments of renew.
+func (r *Redis) times(ttl time.Duration) (int64, int64) {
+	now := r.now()
+	return now.UnixMilli(), now.Add(ttl).UnixMilli()
+}
+
+func (r *Redis) Lease(ctx context.Context, id string, n, limit int, ttl time.Duration) (int, error) {
+	now, expires := r.times(ttl)
+	return leaseScript.Run(ctx, r.client, r.keys, id, now, expires, n, limit).Int()
+}
+
+func (r *Redis) Return(ctx context.Context, id string, n int) error {
+	return returnScript.Run(ctx, r.client, r.keys, id, n).Err()
+}
+
+func (r *Redis) Sync(ctx context.Context, id string, weight int, waiting bool, ttl time.Duration) ([]Replica, error) {
+	now, expires := r.times(ttl)
+	flag := 0
+	if waiting {
+		flag = 1
+	}
+	values, err := syncScript.Run(ctx, r.client, r.keys, id, now, expires, weight, flag).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	replicas := make([]Replica, 0, len(values)/4)
+	for i := 0; i+3 < len(values); i += 4 {
+		held, err1 := strconv.Atoi(values[i+1])
+		weight, err2 := strconv.Atoi(values[i+2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("budget: invalid state of the replica %s: %v", values[i], values[i:i+4])
+		}
+		replicas = append(replicas, Replica{Id: values[i], Held: held, Weight: weight, Waiting: values[i+3] == "1"})
+	}
+	return replicas, nil
+}
@@ -0,0 +1,57 @@
+package budget
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedis returns a Redis backend on a local stand-in of Redis.
+func newRedis(t *testing.T) *Redis {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedis(client, "test:budget:")
+}
+
+func TestRedis(t *testing.T) {
+	c := &clock{now: time.Unix(1000, 0)}
+	r := newRedis(t)
+	r.now = c.Now
+	testBackend(t, r, c)
+	for _, key := range r.keys {
+		if !strings.HasPrefix(key, "{test:budget:}") {
+			t.Errorf("key %s without the hash tag of the prefix", key)
+		}
+	}
+}
+
+func TestRedisReplicas(t *testing.T) {
+	s := &server{}
+	r := newRedis(t)
+	rs := replicas(t, r, s, 8, 1, 3)
+	waitFor(t, "shares of 2 and 6 slots", func() bool {
+		slots := leased(rs)
+		return slots[0] == 2 && slots[1] == 6
+	})
+
+	replicas, err := r.Sync(context.Background(), "observer", 0, false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := 0
+	for _, replica := range replicas {
+		held += replica.Held
+	}
+	if held > 8 {
+		t.Errorf("%d slots leased", held)
+	}
+	if peak := atomic.LoadInt32(&s.peak); peak > 8 {
+		t.Errorf("%d chunks processed in parallel by all replicas", peak)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 )
 
-// Client implements balancer.Client interface.
+// Client implements balancer.Client[int] interface.
 type Client struct {
 	workload int
 	weight   int
@@ -0,0 +1,123 @@
+// Command gateway shares one fragile upstream service among remote clients, see package gateway.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+	"gitlab.com/kiwicom/search-team/balancer/budget"
+	"gitlab.com/kiwicom/search-team/balancer/gateway"
+)
+
+func main() {
+	httpAddr := flag.String("http", ":8080", "serve POST /chunks, /metrics and /status on this address")
+	grpcAddr := flag.String("grpc", "", "serve the gRPC stream on this address, e.g. :9000")
+	upstream := flag.String("upstream", "", "URL the chunks are POSTed to")
+	keysPath := flag.String("keys", "keys.json", `API keys of the clients, {"key": {"id": 1, "weight": 2, "limits": {"rate": 10}}, ...}`)
+	maxParallel := flag.Int("max-parallel", 50, "most chunks the upstream may process in parallel")
+	retries := flag.Int("retries", 0, "how many times a failed chunk is retried")
+	redisAddr := flag.String("redis", "", "share -max-parallel with the other replicas using this Redis, e.g. localhost:6379")
+	replica := flag.String("replica", "", "Id of this replica in the shared budget, the hostname by default")
+	leaseTTL := flag.Duration("lease-ttl", 10*time.Second, "leases of a replica that stops renewing them expire after this, longer than a chunk takes")
+	errorRate := flag.Float64("breaker", 0, "pause sending chunks upstream when this part of the last 20 failed, 0 to pause for -health only")
+	openFor := flag.Duration("breaker-open", 5*time.Second, "pause for this long before probing the upstream again")
+	healthURL := flag.String("health", "", "keep the breaker open while GET of this URL fails")
+	healthInterval := flag.Duration("health-interval", 5*time.Second, "check -health this often")
+	flag.Parse()
+	if *upstream == "" {
+		fmt.Fprintln(os.Stderr, "-upstream is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	keys, err := gateway.LoadKeys(*keysPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	opts := []balancer.Option{
+		balancer.WithRetry(balancer.RetryPolicy{MaxAttempts: *retries + 1, Backoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}),
+	}
+	var shared *budget.Shared
+	if *redisAddr != "" {
+		if *replica == "" {
+			*replica, _ = os.Hostname()
+		}
+		client := redis.NewClient(&redis.Options{Addr: *redisAddr})
+		defer client.Close()
+		shared = budget.New(budget.NewRedis(client, "balancer:budget:"), *replica, *maxParallel, *leaseTTL)
+		opts = append(opts, balancer.WithBudget(shared))
+		fmt.Println("sharing", *maxParallel, "slots as replica", *replica)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := gateway.Forward(&gateway.HTTPUpstream{URL: *upstream})
+	if *errorRate > 0 || *healthURL != "" {
+		breaker := balancer.NewBreaker(*errorRate, 20, *openFor)
+		if *healthURL != "" {
+			go breaker.Watch(ctx, gateway.HealthCheck(*healthURL, nil), *healthInterval)
+		}
+		server = balancer.Protect(server, breaker)
+	}
+	b := balancer.New(server, int32(*maxParallel), opts...)
+	g := gateway.New(b, keys)
+
+	mux := http.NewServeMux()
+	mux.Handle("/chunks", g)
+	mux.Handle("/metrics", b.MetricsHandler())
+	mux.Handle("/status", b.StatusHandler())
+	httpServer := &http.Server{Addr: *httpAddr, Handler: mux}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}()
+	fmt.Println("HTTP gateway listening on", *httpAddr)
+
+	grpcServer := grpc.NewServer()
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		g.RegisterGRPC(grpcServer)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}()
+		fmt.Println("gRPC gateway listening on", *grpcAddr)
+	}
+
+	<-ctx.Done()
+
+	// stop taking new work and let the clients receive the results of the chunks in progress
+	closeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := b.Close(closeCtx); err != nil {
+		fmt.Println("failed to drain the work in progress: ", err)
+	} else if shared != nil {
+		if err := shared.Close(closeCtx); err != nil {
+			fmt.Println("failed to return the leased slots: ", err)
+		}
+	}
+	grpcServer.GracefulStop()
+	if err := httpServer.Shutdown(closeCtx); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package gateway serves a Balancer to remote clients. The clients send their work chunks over HTTP or a gRPC stream,
+// they are identified by API keys with configured weights and get the results of their chunks streamed back as the
+// upstream processes them.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+// APIKeyHeader identifies the client in HTTP requests and in gRPC metadata.
+const APIKeyHeader = "X-API-Key"
+
+// Chunk is a work chunk of a remote client, Data is passed to the upstream as it is.
+type Chunk struct {
+	Seq  int             `json:"seq"` // chosen by the client to match the results, the position in the body for HTTP
+	Data json.RawMessage `json:"data"`
+}
+
+// Result of a chunk, either Data returned by the upstream or Error.
+type Result struct {
+	Seq   int             `json:"seq"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// Key configures the client of an API key. Its Limits apply to all its requests and streams together.
+type Key struct {
+	Id     int             `json:"id"`
+	Weight int             `json:"weight"`
+	Limits balancer.Limits `json:"limits"`
+}
+
+// Keys of the clients allowed to use the gateway.
+type Keys map[string]Key
+
+// LoadKeys reads Keys from a JSON file like {"secret": {"id": 1, "weight": 2}}.
+func LoadKeys(path string) (Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys Keys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range keys {
+		if key.Weight < 1 {
+			return nil, fmt.Errorf("%s: weight of the client %d must be positive", path, key.Id)
+		}
+	}
+	return keys, nil
+}
+
+// Upstream is the fragile service behind the gateway.
+type Upstream interface {
+	Process(ctx context.Context, data json.RawMessage) (json.RawMessage, error)
+}
+
+// UpstreamFunc is an Upstream implemented by a function.
+type UpstreamFunc func(ctx context.Context, data json.RawMessage) (json.RawMessage, error)
+
+func (f UpstreamFunc) Process(ctx context.Context, data json.RawMessage) (json.RawMessage, error) {
+	return f(ctx, data)
+}
+
+// HTTPUpstream posts the data of every chunk to URL and returns the response body, a status other than 2xx is an
+// error.
+type HTTPUpstream struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (u *HTTPUpstream) Process(ctx context.Context, data json.RawMessage) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("upstream: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+// HealthCheck returns a check of the upstream for balancer.Breaker.Watch that GETs url, a status other than 2xx is a
+// failure. client is http.DefaultClient if nil.
+func HealthCheck(url string, client *http.Client) func(ctx context.Context) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("health check: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Forward makes the Server of the Balancer of a Gateway from u.
+func Forward(u Upstream) balancer.Server[Chunk, json.RawMessage] {
+	return forward{u}
+}
+
+type forward struct {
+	u Upstream
+}
+
+func (f forward) Process(ctx context.Context, workChunk Chunk) (json.RawMessage, error) {
+	return f.u.Process(ctx, workChunk.Data)
+}
+
+// Gateway registers every HTTP request and gRPC stream as a client of a Balancer, so the chunks of all remote clients
+// share the upstream by the weights of their keys. Several requests with the same key are separate clients with the
+// same weight and Id, sharing the Limits of the key.
+type Gateway struct {
+	b    *balancer.Balancer[Chunk, json.RawMessage]
+	keys Keys
+
+	mu     sync.Mutex
+	limits map[int]*balancer.SharedLimits // by the Id of the key
+}
+
+// New creates a Gateway for the clients of keys in front of b, see Forward for its Server.
+func New(b *balancer.Balancer[Chunk, json.RawMessage], keys Keys) *Gateway {
+	return &Gateway{b: b, keys: keys, limits: map[int]*balancer.SharedLimits{}}
+}
+
+// sharedLimits returns the Limits of key shared by all its sessions.
+func (g *Gateway) sharedLimits(key Key) *balancer.SharedLimits {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	limits, ok := g.limits[key.Id]
+	if !ok {
+		limits = balancer.NewSharedLimits(key.Limits)
+		g.limits[key.Id] = limits
+	}
+	return limits
+}
+
+// session is a remote client, its chunks are received one by one by recv.
+type session struct {
+	key  Key
+	recv func() (Chunk, error) // io.EOF after the last chunk
+
+	mu  sync.Mutex
+	err error // of recv
+}
+
+func (s *session) Weight() int { return s.key.Weight }
+func (s *session) Id() int     { return s.key.Id }
+
+func (s *session) Workload(ctx context.Context) chan Chunk {
+	workload := make(chan Chunk)
+	go func() {
+		defer close(workload)
+		for {
+			chunk, err := s.recv()
+			if err != nil {
+				if err != io.EOF {
+					s.mu.Lock()
+					s.err = err
+					s.mu.Unlock()
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case workload <- chunk:
+			}
+		}
+	}()
+	return workload
+}
+
+// resultQueue passes the results from OnResult, which must not block, to the client, which may be slow to read them.
+type resultQueue struct {
+	mu      sync.Mutex
+	results []Result
+	pending chan struct{} // has a value when results aren't empty
+}
+
+func (q *resultQueue) push(r Result) {
+	q.mu.Lock()
+	q.results = append(q.results, r)
+	q.mu.Unlock()
+	select {
+	case q.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (q *resultQueue) take() []Result {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	results := q.results
+	q.results = nil
+	return results
+}
+
+// serve registers a session of the client of key and sends the results of its chunks until all of them are
+// processed. It returns the error of recv, or of send after deregistering the session.
+func (g *Gateway) serve(ctx context.Context, key Key, recv func() (Chunk, error), send func(Result) error) error {
+	s := &session{key: key, recv: recv}
+	q := &resultQueue{pending: make(chan struct{}, 1)}
+	opts := []balancer.RegisterOption{balancer.OnResult(func(r balancer.Result[Chunk, json.RawMessage]) {
+		result := Result{Seq: r.Chunk.Seq, Data: r.Value}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+		}
+		q.push(result)
+	})}
+	if key.Limits != (balancer.Limits{}) {
+		opts = append(opts, balancer.WithSharedLimits(g.sharedLimits(key)))
+	}
+	r, err := g.b.Register(ctx, s, opts...)
+	if err != nil {
+		return err
+	}
+
+	// the results are reported before Done is closed, so taking them once more after Done gets them all
+	for done := false; !done; {
+		select {
+		case <-q.pending:
+		case <-r.Done():
+			done = true
+		}
+		for _, result := range q.take() {
+			if err := send(result); err != nil {
+				r.Deregister()
+				return err
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+var testKeys = Keys{"alpha": {Id: 1, Weight: 1}, "beta": {Id: 2, Weight: 3}}
+
+// doubler doubles numbers and fails anything else, it counts the chunks processed in parallel.
+type doubler struct {
+	inFlight, peak int32
+}
+
+func (d *doubler) Process(_ context.Context, data json.RawMessage) (json.RawMessage, error) {
+	n := atomic.AddInt32(&d.inFlight, 1)
+	defer atomic.AddInt32(&d.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&d.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&d.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	var x int
+	if err := json.Unmarshal(data, &x); err != nil {
+		return nil, errors.New("not a number")
+	}
+	return json.RawMessage(strconv.Itoa(2 * x)), nil
+}
+
+func newGateway(u Upstream, maxParallel int32) (*Gateway, *balancer.Balancer[Chunk, json.RawMessage]) {
+	b := balancer.New(Forward(u), maxParallel)
+	return New(b, testKeys), b
+}
+
+// post sends body with key and returns the status and the result lines.
+func post(t *testing.T, url, key, body string) (int, []Result) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set(APIKeyHeader, key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var results []Result
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && resp.StatusCode == http.StatusOK {
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Bytes())
+		}
+		results = append(results, r)
+	}
+	return resp.StatusCode, results
+}
+
+func TestHTTP(t *testing.T) {
+	upstream := &doubler{}
+	g, b := newGateway(upstream, 3)
+	defer b.Close(context.Background())
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	if code, _ := post(t, ts.URL, "gamma", "1"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: %d", code)
+	}
+
+	var body strings.Builder
+	for i := 0; i < 20; i++ {
+		body.WriteString(strconv.Itoa(i) + "\n")
+	}
+	body.WriteString(`"x"`)
+	code, results := post(t, ts.URL, "alpha", body.String())
+	if code != http.StatusOK || len(results) != 21 {
+		t.Fatalf("status %d, %d results", code, len(results))
+	}
+	seen := map[int]bool{}
+	for _, r := range results {
+		seen[r.Seq] = true
+		if r.Seq == 20 && r.Error != "not a number" {
+			t.Errorf("expected an error of %+v", r)
+		} else if r.Seq < 20 && string(r.Data) != strconv.Itoa(2*r.Seq) {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if len(seen) != 21 {
+		t.Errorf("results of %d chunks", len(seen))
+	}
+	if peak := atomic.LoadInt32(&upstream.peak); peak > 3 {
+		t.Errorf("%d chunks processed in parallel", peak)
+	}
+}
+
+func TestSharedLimits(t *testing.T) {
+	b := balancer.New(Forward(&doubler{}), 3)
+	defer b.Close(context.Background())
+	ts := httptest.NewServer(New(b, Keys{"delta": {Id: 4, Weight: 1, Limits: balancer.Limits{Quota: 5}}}))
+	defer ts.Close()
+
+	var results []Result
+	for i := 0; i < 2; i++ {
+		_, r := post(t, ts.URL, "delta", "1\n2\n3")
+		results = append(results, r...)
+	}
+	processed := 0
+	for _, r := range results {
+		if r.Error == "" {
+			processed++
+		} else if r.Error != balancer.ErrQuotaExceeded.Error() {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if processed != 5 {
+		t.Errorf("%d chunks of two requests processed with a quota of 5", processed)
+	}
+}
+
+func TestHTTPInvalidBody(t *testing.T) {
+	g, b := newGateway(&doubler{}, 2)
+	defer b.Close(context.Background())
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	code, results := post(t, ts.URL, "beta", "1 2 {")
+	if code != http.StatusOK || len(results) != 3 {
+		t.Fatalf("status %d, results %+v", code, results)
+	}
+	if last := results[2]; last.Seq != 2 || last.Error == "" {
+		t.Errorf("the invalid chunk isn't reported: %+v", last)
+	}
+
+	b.Close(context.Background())
+	if code, _ := post(t, ts.URL, "beta", "1"); code != http.StatusServiceUnavailable {
+		t.Errorf("closed gateway: %d", code)
+	}
+}
+
+func TestHTTPUpstream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "0" {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	u := &HTTPUpstream{URL: ts.URL}
+	if data, err := u.Process(context.Background(), json.RawMessage(`{"a":1}`)); err != nil || string(data) != `{"a":1}` {
+		t.Errorf("got %s, %v", data, err)
+	}
+	if _, err := u.Process(context.Background(), json.RawMessage(`0`)); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("expected the upstream error, got %v", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	healthy := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	check := HealthCheck(ts.URL, nil)
+	if err := check(context.Background()); err != nil {
+		t.Errorf("healthy upstream: %v", err)
+	}
+	healthy = false
+	if err := check(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the status, got %v", err)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`{"alpha": {"id": 1, "weight": 2, "limits": {"maxInFlight": 5}}}`), 0o600)
+	keys, err := LoadKeys(path)
+	if err != nil || keys["alpha"] != (Key{Id: 1, Weight: 2, Limits: balancer.Limits{MaxInFlight: 5}}) {
+		t.Errorf("got %v, %v", keys, err)
+	}
+
+	os.WriteFile(path, []byte(`{"alpha": {"id": 1}}`), 0o600)
+	if _, err := LoadKeys(path); err == nil {
+		t.Error("loaded a key without weight")
+	}
+}
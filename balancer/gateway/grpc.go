@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+// The gRPC service has a single bidirectional stream, the client sends Chunk messages and receives Result messages.
+// The messages are JSON encoded, so there's nothing to generate: any gRPC client can call it with the content subtype
+// "json", see OpenStream for a Go client.
+const processMethod = "/balancer.Gateway/Process"
+
+// jsonCodec encodes gRPC messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// streamServer is implemented by Gateway, grpc checks it when registering the service.
+type streamServer interface {
+	serveStream(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "balancer.Gateway",
+	HandlerType: (*streamServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Process",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(streamServer).serveStream(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "gateway",
+}
+
+// RegisterGRPC adds the gateway service to s.
+func (g *Gateway) RegisterGRPC(s *grpc.Server) {
+	s.RegisterService(&serviceDesc, g)
+}
+
+func (g *Gateway) serveStream(stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	var key Key
+	ok := false
+	if values := md.Get(APIKeyHeader); len(values) > 0 {
+		key, ok = g.keys[values[0]]
+	}
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unknown API key")
+	}
+
+	err := g.serve(stream.Context(), key, func() (Chunk, error) {
+		var chunk Chunk
+		err := stream.RecvMsg(&chunk)
+		return chunk, err
+	}, func(result Result) error {
+		return stream.SendMsg(&result)
+	})
+	if errors.Is(err, balancer.ErrClosed) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return err
+}
+
+// Stream is the client side of the gRPC stream of a Gateway.
+type Stream struct {
+	grpc.ClientStream
+}
+
+// OpenStream starts sending chunks with apiKey to the Gateway on conn. The stream ends after CloseSend once Recv
+// returned the results of all chunks sent.
+func OpenStream(ctx context.Context, conn grpc.ClientConnInterface, apiKey string) (*Stream, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(APIKeyHeader), apiKey)
+	cs, err := conn.NewStream(ctx, &serviceDesc.Streams[0], processMethod, grpc.CallContentSubtype(jsonCodec{}.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{cs}, nil
+}
+
+func (s *Stream) Send(chunk Chunk) error {
+	return s.SendMsg(&chunk)
+}
+
+// Recv returns the next result, io.EOF after the last one.
+func (s *Stream) Recv() (Result, error) {
+	var result Result
+	err := s.RecvMsg(&result)
+	return result, err
+}
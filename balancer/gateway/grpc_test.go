@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	g, b := newGateway(&doubler{}, 4)
+	defer b.Close(context.Background())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	g.RegisterGRPC(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stream, err := OpenStream(context.Background(), conn, "gamma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unknown key: %v", err)
+	}
+
+	stream, err = OpenStream(context.Background(), conn, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// results stream back while the chunks are being sent
+	for i := 0; i < 10; i++ {
+		if err := stream.Send(Chunk{Seq: 100 + i, Data: json.RawMessage(strconv.Itoa(i))}); err != nil {
+			t.Fatal(err)
+		}
+		if r, err := stream.Recv(); err != nil || r.Seq != 100+i || string(r.Data) != strconv.Itoa(2*i) {
+			t.Fatalf("chunk %d: %+v, %v", i, r, err)
+		}
+	}
+	for i := 10; i < 30; i++ {
+		stream.Send(Chunk{Seq: 100 + i, Data: json.RawMessage(strconv.Itoa(i))})
+	}
+	stream.CloseSend()
+	seen := map[int]bool{}
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[r.Seq] = true
+		if string(r.Data) != strconv.Itoa(2*(r.Seq-100)) {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if len(seen) != 20 {
+		t.Errorf("results of %d chunks after the first 10", len(seen))
+	}
+}
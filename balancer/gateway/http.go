@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+// ServeHTTP takes the JSON values of the request body as the chunks of the client of the APIKeyHeader, the Seq of a
+// chunk is its position in the body. The results are streamed back as JSON lines in the order they are processed, so
+// a client can send its chunks and read the results at the same time. A body that isn't valid JSON ends with a result
+// with the error of the first invalid chunk.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "chunks must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ok := g.keys[r.Header.Get(APIKeyHeader)]
+	if !ok {
+		http.Error(w, "unknown API key", http.StatusUnauthorized)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// HTTP/1 would stop reading the body with the first result otherwise, HTTP/2 is always full duplex
+	_ = rc.EnableFullDuplex()
+
+	dec := json.NewDecoder(r.Body)
+	enc := json.NewEncoder(w)
+	seq, sent := 0, false
+	err := g.serve(r.Context(), key, func() (Chunk, error) {
+		var data json.RawMessage
+		if err := dec.Decode(&data); err != nil {
+			return Chunk{}, err
+		}
+		seq++
+		return Chunk{Seq: seq - 1, Data: data}, nil
+	}, func(result Result) error {
+		if !sent {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			sent = true
+		}
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, balancer.ErrClosed):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case !sent:
+		http.Error(w, fmt.Sprintf("chunk %d: %v", seq, err), http.StatusBadRequest)
+	default:
+		_ = enc.Encode(Result{Seq: seq, Error: err.Error()})
+	}
+}
@@ -2,22 +2,45 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"os"
+	"sort"
 	"time"
 
 	"gitlab.com/kiwicom/search-team/balancer/balancer"
 	"gitlab.com/kiwicom/search-team/balancer/client"
 	"gitlab.com/kiwicom/search-team/balancer/service"
+	"gitlab.com/kiwicom/search-team/balancer/sim"
 )
 
 func main() {
+	metricsAddr := flag.String("metrics", "", "serve /metrics and /status on this address, e.g. :9090")
+	simulate := flag.String("sim", "", "compare the policies on a simulated scenario, or on \"all\" of them, instead of the demo")
+	flag.Parse()
+	if *simulate != "" {
+		if err := simulateScenarios(*simulate); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	rand.Seed(time.Now().UnixNano())
 
 	//maxParallel := int32(50 + rand.Intn(150))
 	maxParallel := int32(50 + rand.Intn(15))
 	fmt.Println("maxParallel: ", maxParallel)
-	b := balancer.New(&service.TheExpensiveFragileService{}, maxParallel)
+	b := balancer.New(balancer.WithoutResults[int](&service.TheExpensiveFragileService{}), maxParallel)
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", b.MetricsHandler())
+		mux.Handle("/status", b.StatusHandler())
+		go func() {
+			fmt.Println(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
@@ -38,4 +61,35 @@ func main() {
 		}(i)
 	}
 	<-ctx.Done()
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), time.Second)
+	defer cancelClose()
+	if err := b.Close(closeCtx); err != nil {
+		fmt.Println("failed to drain the work in progress: ", err)
+	}
+}
+
+func simulateScenarios(name string) error {
+	scenarios := sim.Scenarios()
+	var names []string
+	if name == "all" {
+		for n := range scenarios {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+	} else if _, ok := scenarios[name]; ok {
+		names = []string{name}
+	} else {
+		return fmt.Errorf("unknown scenario %q", name)
+	}
+
+	var reports []*sim.Report
+	for _, n := range names {
+		rs, err := sim.Compare(scenarios[n], sim.Policies())
+		if err != nil {
+			return err
+		}
+		reports = append(reports, rs...)
+	}
+	return sim.WriteReports(os.Stdout, reports)
 }
@@ -0,0 +1,413 @@
+// Package queue keeps the chunks of the clients of a Balancer in a file until they are processed, so that a crash
+// doesn't lose them. A chunk is appended to the log with Put before the Balancer sees it, and acknowledged once the
+// Server processed it successfully. Opening the log again delivers the chunks that weren't acknowledged.
+//
+// The delivery is at least once: a chunk processed right before a crash, or one that failed, is delivered again. The
+// Server must tolerate duplicates. A chunk fails once the retries of the RetryPolicy of the Balancer are over, the
+// Queue delivers it again after RedeliverAfter.
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+// ErrClosed is returned by Put to a closed Queue.
+var ErrClosed = errors.New("queue closed")
+
+// Entry is a chunk of a client in the Queue, the chunk type of its Balancer.
+type Entry[T any] struct {
+	Client int
+	Seq    uint64 // unique in the Queue, increasing in the order of Put
+	Chunk  T
+}
+
+// record is a line of the log, a Put or an acknowledgement of the entry Seq.
+type record struct {
+	Ack    bool            `json:"ack,omitempty"`
+	Client int             `json:"client"`
+	Seq    uint64          `json:"seq"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Queue is a durable queue of chunks of type T, stored as JSON in an append-only log. The log is compacted to the
+// pending entries by Open and once CompactAfter entries were acknowledged.
+type Queue[T any] struct {
+	// RedeliverAfter is how long a failed entry of a Client that isn't ordered waits before it's delivered again, and
+	// CompactAfter how many acknowledgements are appended to the log before it's compacted. They are set by Open and
+	// may be changed before the Queue is used.
+	RedeliverAfter time.Duration
+	CompactAfter   int
+
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	seq     uint64
+	pending map[int][]*pending[T] // entries of a client that weren't acknowledged, by Seq
+	acked   int                   // acknowledgements appended since the last compaction
+	err     error                 // of the first write of an acknowledgement or a compaction that failed
+	changed chan struct{}         // closed and replaced when an entry was added or settled
+	closed  bool
+}
+
+type pending[T any] struct {
+	Entry[T]
+	delivered bool // by the Client of its client
+	redeliver bool // the Client isn't ordered, it delivers the entry again if it fails
+	failed    bool // since it was delivered
+}
+
+// Open opens the log at path, creating it if it doesn't exist. The entries that weren't acknowledged are kept, the
+// log is compacted to them. A line cut short by a crash is ignored.
+func Open[T any](path string) (*Queue[T], error) {
+	q := &Queue[T]{
+		RedeliverAfter: time.Second,
+		CompactAfter:   1000,
+		path:           path,
+		pending:        map[int][]*pending[T]{},
+		changed:        make(chan struct{}),
+	}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// replay reads the log into q.pending.
+func (q *Queue[T]) replay() error {
+	f, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	acked := map[uint64]bool{}
+	var puts []Entry[T]
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			if !scanner.Scan() {
+				break // the last line, written partially
+			}
+			return fmt.Errorf("%s:%d: %w", q.path, line, err)
+		}
+		if r.Seq > q.seq {
+			q.seq = r.Seq
+		}
+		if r.Ack {
+			acked[r.Seq] = true
+			continue
+		}
+		e := Entry[T]{Client: r.Client, Seq: r.Seq}
+		if err := json.Unmarshal(r.Data, &e.Chunk); err != nil {
+			return fmt.Errorf("%s:%d: %w", q.path, line, err)
+		}
+		puts = append(puts, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, e := range puts {
+		if !acked[e.Seq] {
+			q.pending[e.Client] = append(q.pending[e.Client], &pending[T]{Entry: e})
+		}
+	}
+	return nil
+}
+
+// compact rewrites the log with the pending entries only and opens it for appending, q.mu must be held once the
+// Queue is used.
+func (q *Queue[T]) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), ".queue-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, entries := range q.pending {
+		for _, p := range entries {
+			data, err := json.Marshal(p.Chunk)
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+			line, _ := json.Marshal(record{Client: p.Client, Seq: p.Seq, Data: data})
+			w.Write(append(line, '\n'))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), q.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if q.file != nil {
+		q.file.Close() // of the log before the compaction
+	}
+	q.file, q.acked = file, 0
+	return nil
+}
+
+// append writes r to the log and syncs it to the disk if sync, q.mu must be held.
+func (q *Queue[T]) append(r record, sync bool) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if sync {
+		return q.file.Sync()
+	}
+	return nil
+}
+
+// notify wakes the workloads waiting for a change, q.mu must be held.
+func (q *Queue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Put appends chunk of the client to the queue. It returns once the chunk is on the disk.
+func (q *Queue[T]) Put(client int, chunk T) (Entry[T], error) {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return Entry[T]{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Entry[T]{}, ErrClosed
+	}
+	e := Entry[T]{Client: client, Seq: q.seq + 1, Chunk: chunk}
+	if err := q.append(record{Client: client, Seq: e.Seq, Data: data}, true); err != nil {
+		return Entry[T]{}, err
+	}
+	q.seq = e.Seq
+	q.pending[client] = append(q.pending[client], &pending[T]{Entry: e})
+	q.notify()
+	return e, nil
+}
+
+// Pending returns the entries of the client that weren't acknowledged, in the order of Put.
+func (q *Queue[T]) Pending(client int) []Entry[T] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := make([]Entry[T], len(q.pending[client]))
+	for i, p := range q.pending[client] {
+		entries[i] = p.Entry
+	}
+	return entries
+}
+
+// settle records the final result of the entry e, err is nil if it was processed. A processed entry is acknowledged
+// and removed. A failed one is delivered again after RedeliverAfter unless its Client is ordered, then it stays
+// pending until the next Client of its client.
+func (q *Queue[T]) settle(e Entry[T], err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.pending[e.Client]
+	for i, p := range entries {
+		if p.Seq != e.Seq {
+			continue
+		}
+		if err != nil {
+			p.failed = true
+			if p.redeliver {
+				time.AfterFunc(q.RedeliverAfter, func() { q.redeliver(p) })
+			}
+			break
+		}
+		q.pending[e.Client] = append(entries[:i], entries[i+1:]...)
+		if len(q.pending[e.Client]) == 0 {
+			delete(q.pending, e.Client)
+		}
+		if !q.closed {
+			q.acknowledge(e)
+		}
+		break
+	}
+	q.notify()
+}
+
+// acknowledge appends the acknowledgement of e to the log and compacts it after CompactAfter of them, q.mu must be
+// held. A write that failed is returned by Close, the entry is delivered again by the next Open then.
+func (q *Queue[T]) acknowledge(e Entry[T]) {
+	// a lost acknowledgement only delivers the entry again, it doesn't need a sync
+	err := q.append(record{Ack: true, Client: e.Client, Seq: e.Seq}, false)
+	if err == nil {
+		if q.acked++; q.acked >= q.CompactAfter {
+			err = q.compact()
+		}
+	}
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+// redeliver makes the failed entry p available to the workload of its Client again.
+func (q *Queue[T]) redeliver(p *pending[T]) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || !p.failed {
+		return // a new Client delivered it already
+	}
+	p.delivered, p.failed = false, false
+	q.notify()
+}
+
+// Close closes the log and ends the workloads of the clients. The entries being processed are delivered again by the
+// next Open unless they were acknowledged. It returns the error of the first acknowledgement that wasn't written.
+func (q *Queue[T]) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notify()
+	return errors.Join(q.err, q.file.Close())
+}
+
+// Client makes a client of the Balancer delivering the pending entries of the client id, which must be registered
+// with OnResult of q. An ordered client delivers an entry once the one before it was processed and stops at the first
+// one that failed, so that the entries are processed one by one in the order of Put, the failed one is delivered
+// again by the next Client. Otherwise the entries are delivered in the order of Put and processed in parallel, a
+// failed one is delivered again after RedeliverAfter.
+//
+// The workload of the client waits for more entries until its context is done or q is closed. Only one Client of an
+// id should be registered at a time.
+func (q *Queue[T]) Client(id, weight int, ordered bool) balancer.Client[Entry[T]] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, p := range q.pending[id] {
+		p.delivered, p.failed = false, false
+	}
+	return &client[T]{q: q, id: id, weight: weight, ordered: ordered}
+}
+
+type client[T any] struct {
+	q          *Queue[T]
+	id, weight int
+	ordered    bool
+}
+
+func (c *client[T]) Id() int     { return c.id }
+func (c *client[T]) Weight() int { return c.weight }
+
+func (c *client[T]) Workload(ctx context.Context) chan Entry[T] {
+	workload := make(chan Entry[T])
+	go func() {
+		defer close(workload)
+		for {
+			e, ok, changed := c.next()
+			if ok {
+				select {
+				case workload <- e:
+					continue
+				case <-ctx.Done():
+					c.undeliver(e)
+					return
+				}
+			}
+			if changed == nil {
+				return
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return workload
+}
+
+// next takes the next entry to deliver. Without one it returns the channel closed on the next change of the queue,
+// nil if the workload is over.
+func (c *client[T]) next() (Entry[T], bool, <-chan struct{}) {
+	c.q.mu.Lock()
+	defer c.q.mu.Unlock()
+	if c.q.closed {
+		return Entry[T]{}, false, nil
+	}
+	for _, p := range c.q.pending[c.id] {
+		if !p.delivered {
+			p.delivered, p.redeliver = true, !c.ordered
+			return p.Entry, true, nil
+		}
+		if c.ordered {
+			if p.failed {
+				return Entry[T]{}, false, nil
+			}
+			break // processing
+		}
+	}
+	return Entry[T]{}, false, c.q.changed
+}
+
+// undeliver makes the entry e that wasn't taken by the Balancer available again.
+func (c *client[T]) undeliver(e Entry[T]) {
+	c.q.mu.Lock()
+	defer c.q.mu.Unlock()
+	for _, p := range c.q.pending[c.id] {
+		if p.Seq == e.Seq {
+			p.delivered = false
+		}
+	}
+}
+
+// OnResult acknowledges the entries of a Client of q processed by the Balancer and then calls f, if it's not nil,
+// with their results.
+func OnResult[T, R any](q *Queue[T], f func(balancer.Result[Entry[T], R])) balancer.RegisterOption {
+	return balancer.OnResult(func(r balancer.Result[Entry[T], R]) {
+		q.settle(r.Chunk, r.Err)
+		if f != nil {
+			f(r)
+		}
+	})
+}
+
+// Server makes the Server of the Balancer of a Queue from server processing the chunks of the entries.
+func Server[T, R any](server balancer.Server[T, R]) balancer.Server[Entry[T], R] {
+	return entryServer[T, R]{server}
+}
+
+type entryServer[T, R any] struct {
+	server balancer.Server[T, R]
+}
+
+func (s entryServer[T, R]) Process(ctx context.Context, e Entry[T]) (R, error) {
+	return s.server.Process(ctx, e.Chunk)
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+var errTest = errors.New("test failure")
+
+// recorder records the chunks in the order they were processed, fail decides their error.
+type recorder struct {
+	mu        sync.Mutex
+	processed []int
+	fail      func(chunk int) error
+}
+
+func (s *recorder) Process(_ context.Context, chunk int) (int, error) {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	s.processed = append(s.processed, chunk)
+	s.mu.Unlock()
+	if s.fail != nil {
+		return chunk, s.fail(chunk)
+	}
+	return chunk, nil
+}
+
+func chunks(entries []Entry[int]) []int {
+	cs := make([]int, len(entries))
+	for i, e := range entries {
+		cs[i] = e.Chunk
+	}
+	return cs
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, err := Open[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry[int]
+	for i := 0; i < 5; i++ {
+		e, err := q.Put(1+i%2, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	q.settle(entries[0], nil)
+	q.settle(entries[3], nil)
+	q.settle(entries[2], errTest)
+	q.Close()
+	if _, err := q.Put(1, 5); !errors.Is(err, ErrClosed) {
+		t.Errorf("put to a closed queue: %v", err)
+	}
+
+	// a crash in the middle of a line
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"client":1,"seq":6,"da`)
+	f.Close()
+
+	q, err = Open[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if one, two := chunks(q.Pending(1)), chunks(q.Pending(2)); !reflect.DeepEqual(one, []int{2, 4}) || !reflect.DeepEqual(two, []int{1}) {
+		t.Errorf("pending %v and %v", one, two)
+	}
+	if e, _ := q.Put(2, 6); e.Seq != 6 {
+		t.Errorf("put after a restart got %d", e.Seq)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("log of %d lines after the compaction:\n%s", lines, data)
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	os.WriteFile(path, []byte("{\"client\":1,\"seq\":1,\"data\":1}\nnot json\n{\"ack\":true,\"client\":1,\"seq\":1}\n"), 0o600)
+	if _, err := Open[int](path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected an error of the second line, got %v", err)
+	}
+}
+
+func TestRedelivery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, _ := Open[int](path)
+	q.RedeliverAfter = time.Hour
+	for i := 0; i < 10; i++ {
+		q.Put(1, i)
+	}
+	server := &recorder{fail: func(chunk int) error {
+		if chunk == 3 {
+			return errTest
+		}
+		return nil
+	}}
+	b := balancer.New(Server[int, int](server), 4)
+	b.Register(context.Background(), q.Client(1, 1, false), OnResult[int, int](q, nil))
+	waitFor(t, "the chunks processed", func() bool { return len(q.Pending(1)) == 1 && b.Status().InFlight == 0 })
+	b.Close(context.Background())
+	q.Close()
+
+	// the failed chunk is delivered again after a restart
+	q, _ = Open[int](path)
+	defer q.Close()
+	if pending := chunks(q.Pending(1)); !reflect.DeepEqual(pending, []int{3}) {
+		t.Fatalf("pending %v", pending)
+	}
+	server.fail = nil
+	b = balancer.New(Server[int, int](server), 4)
+	defer b.Close(context.Background())
+	var results []balancer.Result[Entry[int], int]
+	var mu sync.Mutex
+	b.Register(context.Background(), q.Client(1, 1, false), OnResult(q, func(r balancer.Result[Entry[int], int]) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	}))
+	waitFor(t, "the redelivered chunk", func() bool { return len(q.Pending(1)) == 0 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 1 || results[0].Chunk.Chunk != 3 || results[0].Value != 3 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestRedeliveryAfter(t *testing.T) {
+	q, _ := Open[int](filepath.Join(t.TempDir(), "queue.log"))
+	defer q.Close()
+	q.RedeliverAfter = 10 * time.Millisecond
+	failures := 0
+	server := &recorder{fail: func(chunk int) error {
+		if chunk == 3 && failures < 2 {
+			failures++
+			return errTest
+		}
+		return nil
+	}}
+	b := balancer.New(Server[int, int](server), 4)
+	defer b.Close(context.Background())
+
+	// the failed chunk is delivered again by the same client
+	b.Register(context.Background(), q.Client(1, 1, false), OnResult[int, int](q, nil))
+	for i := 0; i < 10; i++ {
+		q.Put(1, i)
+	}
+	waitFor(t, "the chunks processed", func() bool { return len(q.Pending(1)) == 0 })
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.processed) != 12 {
+		t.Errorf("processed %v", server.processed)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.log")
+	q, _ := Open[int](path)
+	q.CompactAfter = 4
+	for i := 0; i < 10; i++ {
+		q.Put(1, i)
+	}
+	b := balancer.New(Server[int, int](&recorder{}), 4)
+	defer b.Close(context.Background())
+	b.Register(context.Background(), q.Client(1, 1, false), OnResult[int, int](q, nil))
+	waitFor(t, "the chunks processed", func() bool { return len(q.Pending(1)) == 0 })
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// compacted after the 4th and the 8th acknowledgement
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("log of %d lines:\n%s", lines, data)
+	}
+	q, err := Open[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if pending := q.Pending(1); len(pending) != 0 {
+		t.Errorf("pending %v", pending)
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	q, _ := Open[int](filepath.Join(t.TempDir(), "queue.log"))
+	defer q.Close()
+	server := &recorder{fail: func(chunk int) error {
+		if chunk == 6 {
+			return errTest
+		}
+		return nil
+	}}
+	b := balancer.New(Server[int, int](server), 4)
+	defer b.Close(context.Background())
+
+	r, _ := b.Register(context.Background(), q.Client(1, 1, true), OnResult[int, int](q, nil))
+	for i := 0; i < 10; i++ {
+		q.Put(1, i)
+	}
+	// the client stops at the failed chunk, it and the later ones wait for the next client
+	r.Wait()
+	if pending := chunks(q.Pending(1)); !reflect.DeepEqual(pending, []int{6, 7, 8, 9}) {
+		t.Errorf("pending %v", pending)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !reflect.DeepEqual(server.processed, []int{0, 1, 2, 3, 4, 5, 6}) {
+		t.Errorf("processed %v", server.processed)
+	}
+}
@@ -8,7 +8,7 @@ import (
 
 // TheExpensiveFragileService is a service that we need to utilise as much as we can, since it's expensive to run,
 // but on the other hand is very fragile, so we can't just flood it with thousands of requests per second.
-// It implements balancer.Server interface.
+// It implements balancer.Processor[int] interface, use balancer.WithoutResults to balance it.
 type TheExpensiveFragileService struct{}
 
 // Process a single work chunk and return error if occurred.
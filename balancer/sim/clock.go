@@ -0,0 +1,74 @@
+package sim
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Clock is a virtual clock, time only passes by running the scheduled functions in the order of their time, and of
+// scheduling for the same time.
+type Clock struct {
+	now    time.Duration
+	seq    int
+	events events
+}
+
+type event struct {
+	at  time.Duration
+	seq int
+	f   func()
+}
+
+type events []event
+
+func (e events) Len() int { return len(e) }
+func (e events) Less(i, j int) bool {
+	return e[i].at < e[j].at || e[i].at == e[j].at && e[i].seq < e[j].seq
+}
+func (e events) Swap(i, j int)       { e[i], e[j] = e[j], e[i] }
+func (e *events) Push(x interface{}) { *e = append(*e, x.(event)) }
+func (e *events) Pop() interface{} {
+	old := *e
+	x := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return x
+}
+
+// Now returns the time since the start.
+func (c *Clock) Now() time.Duration {
+	return c.now
+}
+
+// At schedules f at the time at, or now if it's in the past.
+func (c *Clock) At(at time.Duration, f func()) {
+	if at < c.now {
+		at = c.now
+	}
+	c.seq++
+	heap.Push(&c.events, event{at: at, seq: c.seq, f: f})
+}
+
+// After schedules f after d.
+func (c *Clock) After(d time.Duration, f func()) {
+	c.At(c.now+d, f)
+}
+
+// Next returns the time of the next scheduled function, false if there is none.
+func (c *Clock) Next() (time.Duration, bool) {
+	if len(c.events) == 0 {
+		return 0, false
+	}
+	return c.events[0].at, true
+}
+
+// Step advances the clock to the next scheduled function and runs it, the functions scheduled for the same time run
+// one per Step. It returns false if nothing was scheduled.
+func (c *Clock) Step() bool {
+	if len(c.events) == 0 {
+		return false
+	}
+	e := heap.Pop(&c.events).(event)
+	c.now = e.at
+	e.f()
+	return true
+}
@@ -0,0 +1,114 @@
+package sim
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Report of a run of a Scenario with a Policy.
+type Report struct {
+	Scenario, Policy string
+	Elapsed          time.Duration // virtual time of the run
+	MaxParallel      int
+	PeakInFlight     int
+	// Utilisation is the part of the slots processing chunks while chunks were waiting, 1 if a slot was never free
+	// with a chunk waiting for it.
+	Utilisation float64
+	// Fairness is Jain's index of the clients' slots relative to their weighted shares while they had a chunk ready,
+	// 1 if every client got exactly its share, 1/n if one of n clients got everything.
+	Fairness float64
+	Clients  []ClientReport
+}
+
+// ClientReport describes how a client was served.
+type ClientReport struct {
+	Id, Weight int
+	Completed  int
+	Dropped    int // ready when the client left
+	// Received and Entitled are the average slots of the client and its weighted share of them while it had a chunk
+	// ready.
+	Received, Entitled float64
+	MeanWait, MaxWait  time.Duration // of a ready chunk for a slot
+	Finished           time.Duration // when its last chunk was processed
+}
+
+func (r *run) report(policy string) *Report {
+	report := &Report{
+		Scenario:     r.s.Name,
+		Policy:       policy,
+		Elapsed:      r.clock.Now(),
+		MaxParallel:  r.s.MaxParallel,
+		PeakInFlight: r.peak,
+		Utilisation:  1,
+	}
+	if r.demanded > 0 {
+		report.Utilisation = r.used / r.demanded
+	}
+
+	var sum, squares float64
+	n := 0
+	for _, c := range r.clients {
+		cr := ClientReport{
+			Id:        c.spec.Id,
+			Weight:    c.spec.Weight,
+			Completed: c.completed,
+			Dropped:   c.dropped,
+			MaxWait:   c.maxWait,
+			Finished:  c.finished,
+		}
+		if c.started > 0 {
+			cr.MeanWait = c.wait / time.Duration(c.started)
+		}
+		if c.entitled > 0 {
+			cr.Received, cr.Entitled = c.received/c.backlogged, c.entitled/c.backlogged
+			x := c.received / c.entitled
+			sum += x
+			squares += x * x
+			n++
+		}
+		report.Clients = append(report.Clients, cr)
+	}
+	report.Fairness = 1
+	if squares > 0 {
+		report.Fairness = sum * sum / (float64(n) * squares)
+	}
+	return report
+}
+
+// Compare runs s with every policy of ps.
+func Compare(s Scenario, ps []Policy) ([]*Report, error) {
+	reports := make([]*Report, 0, len(ps))
+	for _, p := range ps {
+		report, err := Run(s, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s with %s: %w", s.Name, p.Name, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// WriteReports writes the reports as a table.
+func WriteReports(w io.Writer, reports []*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "scenario\tpolicy\telapsed\tpeak\tutilisation\tfairness\tclient\tweight\tcompleted\tdropped\treceived/entitled\tmean wait\tmax wait")
+	for _, r := range reports {
+		for i, c := range r.Clients {
+			share := "-"
+			if c.Entitled > 0 {
+				share = fmt.Sprintf("%.2f", c.Received/c.Entitled)
+			}
+			if i == 0 {
+				fmt.Fprintf(tw, "%s\t%s\t%v\t%d/%d\t%.3f\t%.3f\t", r.Scenario, r.Policy, r.Elapsed.Round(time.Millisecond),
+					r.PeakInFlight, r.MaxParallel, r.Utilisation, r.Fairness)
+			} else {
+				fmt.Fprint(tw, "\t\t\t\t\t\t")
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%v\t%v\n", c.Id, c.Weight, c.Completed, c.Dropped, share,
+				c.MeanWait.Round(time.Microsecond), c.MaxWait.Round(time.Microsecond))
+		}
+	}
+	return tw.Flush()
+}
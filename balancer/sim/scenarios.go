@@ -0,0 +1,64 @@
+package sim
+
+import (
+	"time"
+)
+
+// Scenarios returns the built-in scenarios by name.
+func Scenarios() map[string]Scenario {
+	ms := time.Millisecond
+	scenarios := []Scenario{
+		{
+			// the example of the Balancer doc comment: 25/25/50, then 50/50 once the heavy client is done
+			Name:        "doc",
+			MaxParallel: 100,
+			Latency:     Uniform{Min: 5 * ms, Max: 15 * ms},
+			Clients: []Client{
+				{Id: 1, Weight: 1, Chunks: 4000},
+				{Id: 2, Weight: 1, Chunks: 4000},
+				{Id: 3, Weight: 2, Chunks: 3000},
+			},
+		},
+		{
+			// clients keep arriving and leaving while the others are served
+			Name:        "churn",
+			MaxParallel: 20,
+			Latency:     Exponential{Mean: 20 * ms},
+			Duration:    10 * time.Second,
+			Clients: []Client{
+				{Id: 1, Weight: 1, Chunks: -1},
+				{Id: 2, Weight: 3, Chunks: -1, Arrive: 2 * time.Second, Leave: 6 * time.Second},
+				{Id: 3, Weight: 2, Chunks: 2000, Arrive: 4 * time.Second},
+				{Id: 4, Weight: 1, Chunks: -1, Arrive: 5 * time.Second, Leave: 9 * time.Second},
+			},
+		},
+		{
+			// a client that produces its chunks slowly must not waste the slots it doesn't use
+			Name:        "slow-producer",
+			MaxParallel: 20,
+			Latency:     Constant(10 * ms),
+			Clients: []Client{
+				{Id: 1, Weight: 5, Chunks: 500, Interval: 5 * ms},
+				{Id: 2, Weight: 1, Chunks: 5000},
+			},
+		},
+		{
+			// a few chunks take much longer than the rest
+			Name:        "heavy-tail",
+			MaxParallel: 30,
+			Latency:     LogNormal{Median: 10 * ms, Sigma: 1.5},
+			Clients: []Client{
+				{Id: 1, Weight: 1, Chunks: 1000},
+				{Id: 2, Weight: 2, Chunks: 1000},
+				{Id: 3, Weight: 3, Chunks: 1000, Latency: Constant(10 * ms)},
+			},
+		},
+	}
+
+	byName := map[string]Scenario{}
+	for i, s := range scenarios {
+		s.Seed = int64(i + 1)
+		byName[s.Name] = s
+	}
+	return byName
+}
@@ -0,0 +1,469 @@
+// Package sim replays scripted scenarios of clients arriving at and leaving a Balancer in virtual time, so that the
+// scheduling policies can be compared in milliseconds instead of running a live demo for minutes.
+//
+// A run drives a real Balancer with a simulated Server that takes the time drawn from a latency distribution with a
+// seeded random source. The virtual time passes only once the Balancer has settled: the chunks it took are either
+// processed or waiting, and none waits while a slot is free. The events of the scenario are played one at a time, so
+// a run is reproducible. The Server counts the chunks it processes in parallel, more than MaxParallel of them fail
+// the run.
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"gitlab.com/kiwicom/search-team/balancer/balancer"
+)
+
+var (
+	// ErrInvariant is returned when a run breaks a guarantee of the Balancer.
+	ErrInvariant = errors.New("invariant violated")
+	// errStopped is the error of the chunks being processed when a run stops.
+	errStopped = errors.New("run stopped")
+)
+
+// settleTimeout is the real time the Balancer gets to react to an event of a run.
+const settleTimeout = 10 * time.Second
+
+// Latency is a distribution of the time the server takes to process a chunk.
+type Latency interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// Constant latency.
+type Constant time.Duration
+
+func (c Constant) Sample(*rand.Rand) time.Duration { return time.Duration(c) }
+
+// Uniform latency between Min and Max.
+type Uniform struct {
+	Min, Max time.Duration
+}
+
+func (u Uniform) Sample(r *rand.Rand) time.Duration {
+	return u.Min + time.Duration(r.Int63n(int64(u.Max-u.Min)+1))
+}
+
+// Exponential latency with Mean.
+type Exponential struct {
+	Mean time.Duration
+}
+
+func (e Exponential) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(e.Mean))
+}
+
+// LogNormal latency with Median, heavy tailed for large Sigma.
+type LogNormal struct {
+	Median time.Duration
+	Sigma  float64
+}
+
+func (l LogNormal) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(float64(l.Median) * math.Exp(l.Sigma*r.NormFloat64()))
+}
+
+// Client is the script of a client in a Scenario.
+type Client struct {
+	Id, Weight int
+	Arrive     time.Duration // registers at
+	Leave      time.Duration // deregisters at, 0 to stay until its chunks are processed
+	Chunks     int           // -1 for chunks until it leaves
+	Interval   time.Duration // it takes to produce the next chunk, 0 to have it ready right away
+	Latency    Latency       // of its chunks, the Scenario's if nil
+}
+
+// Scenario of clients of a server.
+type Scenario struct {
+	Name        string
+	MaxParallel int
+	Latency     Latency
+	Clients     []Client
+	Duration    time.Duration // the run stops after it, 0 to run until all clients are done
+	Seed        int64
+}
+
+// Policy names a constructor of a balancer.Policy, r is the random source of the run.
+type Policy struct {
+	Name string
+	New  func(r *rand.Rand) balancer.Policy
+}
+
+// Policies returns the policies of the balancer package.
+func Policies() []Policy {
+	return []Policy{
+		{"slot-share", func(*rand.Rand) balancer.Policy { return balancer.NewSlotShare() }},
+		{"wfq", func(*rand.Rand) balancer.Policy { return balancer.NewWFQ() }},
+		{"round-robin", func(*rand.Rand) balancer.Policy { return balancer.NewRoundRobin() }},
+		{"strict-priority", func(*rand.Rand) balancer.Policy { return balancer.NewStrictPriority(8) }},
+		{"random", func(r *rand.Rand) balancer.Policy { return balancer.NewRandom(r) }},
+	}
+}
+
+// chunk of a client, processed by the server of a run.
+type chunk struct {
+	client *client
+}
+
+// client implements balancer.Client, the run offers its chunks on workload.
+type client struct {
+	spec         Client
+	workload     chan *chunk
+	registration *balancer.Registration[*chunk, struct{}]
+	registered   bool
+	remaining    int  // chunks not produced yet, negative for endless
+	available    bool // the next chunk is produced and not taken by the Balancer yet
+	readyAt      time.Duration
+
+	taken, started, running int // chunks taken by the Balancer, handed to the server and being processed
+	completed, dropped      int
+	wait, maxWait           time.Duration
+	finished                time.Duration
+	backlogged              float64 // seconds the client had a chunk waiting
+	received, entitled      float64 // slot-seconds while it had a chunk waiting
+}
+
+func (c *client) Weight() int { return c.spec.Weight }
+func (c *client) Id() int     { return c.spec.Id }
+
+func (c *client) Workload(context.Context) chan *chunk {
+	return c.workload
+}
+
+// waiting returns the chunks of c taken by the Balancer and not processed yet.
+func (c *client) waiting() int {
+	return c.taken - c.started - c.dropped
+}
+
+type run struct {
+	s         Scenario
+	b         *balancer.Balancer[*chunk, struct{}]
+	latencies *rand.Rand
+	stop      chan struct{} // closed when the run is over, ends the chunks being processed
+
+	mu        sync.Mutex // guards the fields below, the Balancer changes them from its goroutines
+	clock     Clock
+	clients   []*client
+	running   int // Process calls that didn't return
+	returning int // of them whose chunk was processed in virtual time
+	peak      int
+	changes   int // of the counters, the Balancer is settled only if they don't change while it's looked at
+	err       error
+
+	used, demanded float64 // slot-seconds processing chunks and that could have processed them
+}
+
+// Run replays s with the policy p and reports how the server was shared.
+func Run(s Scenario, p Policy) (*Report, error) {
+	return simulate(s, p, s.MaxParallel)
+}
+
+// simulate replays s with a Balancer of slots, the server takes at most s.MaxParallel chunks in parallel.
+func simulate(s Scenario, p Policy, slots int) (*Report, error) {
+	if s.MaxParallel < 1 {
+		return nil, fmt.Errorf("%s: MaxParallel must be positive", s.Name)
+	}
+	r := &run{s: s, latencies: rand.New(rand.NewSource(s.Seed)), stop: make(chan struct{})}
+	ids := map[int]bool{}
+	for _, spec := range s.Clients {
+		c := &client{spec: spec, workload: make(chan *chunk), remaining: spec.Chunks}
+		if c.spec.Latency == nil {
+			c.spec.Latency = s.Latency
+		}
+		if c.spec.Latency == nil {
+			return nil, fmt.Errorf("%s: no latency of the client %d", s.Name, spec.Id)
+		}
+		if spec.Chunks < 0 && spec.Leave == 0 && s.Duration == 0 {
+			return nil, fmt.Errorf("%s: the client %d never stops", s.Name, spec.Id)
+		}
+		if ids[spec.Id] {
+			return nil, fmt.Errorf("%s: the client %d is there twice", s.Name, spec.Id)
+		}
+		ids[spec.Id] = true
+		r.clients = append(r.clients, c)
+		r.clock.At(spec.Arrive, func() { r.arrive(c) })
+		if spec.Leave > 0 {
+			r.clock.At(spec.Leave, func() { r.leave(c) })
+		}
+	}
+
+	policy := p.New(rand.New(rand.NewSource(s.Seed)))
+	r.b = balancer.New[*chunk, struct{}](server{r}, int32(slots), balancer.WithPolicy(policy))
+	err := r.play()
+	// reported before Close drops the chunks that wait
+	r.mu.Lock()
+	report := r.report(p.Name)
+	r.mu.Unlock()
+	close(r.stop)
+	if closeErr := r.b.Close(context.Background()); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// play runs the events one at a time, each once the Balancer settled after the previous one.
+func (r *run) play() error {
+	for {
+		if err := r.settle(); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		next, ok := r.clock.Next()
+		if !ok {
+			r.mu.Unlock()
+			return nil
+		}
+		if r.s.Duration > 0 && next > r.s.Duration {
+			r.account(r.s.Duration - r.clock.Now())
+			r.clock.now = r.s.Duration
+			r.mu.Unlock()
+			return nil
+		}
+		r.account(next - r.clock.Now())
+		r.clock.Step()
+		r.mu.Unlock()
+	}
+}
+
+// settle waits until the Balancer has reacted to the last event, offering the produced chunks to it one at a time so
+// that the policy always picks from the same clients.
+func (r *run) settle() error {
+	deadline := time.Now().Add(settleTimeout)
+	for {
+		r.mu.Lock()
+		err, changes := r.err, r.changes
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		status := r.b.Status()
+
+		r.mu.Lock()
+		if status.InFlight > int(status.MaxParallel) {
+			r.err = fmt.Errorf("%w: at %v the Balancer has %d chunks in flight, at most %d allowed", ErrInvariant,
+				r.clock.Now(), status.InFlight, status.MaxParallel)
+		}
+		if r.err == nil && r.changes == changes && r.settled(status) {
+			c := r.next()
+			if c == nil {
+				r.mu.Unlock()
+				return nil
+			}
+			if err := r.offer(c); err != nil {
+				return err
+			}
+			deadline = time.Now().Add(settleTimeout)
+			continue
+		}
+		now := r.clock.Now()
+		r.mu.Unlock()
+		if time.Now().After(deadline) {
+			return fmt.Errorf("at %v the Balancer didn't settle in %v", now, settleTimeout)
+		}
+		runtime.Gosched()
+	}
+}
+
+// settled reports whether status agrees with the counts of the run and no chunk waits while a slot is free, r.mu
+// must be held.
+func (r *run) settled(status balancer.Status) bool {
+	if r.returning > 0 || status.InFlight != r.running {
+		return false // a chunk is on its way to the server or its result to the Balancer
+	}
+	clients := map[int]balancer.ClientStatus{}
+	for _, cs := range status.Clients {
+		clients[cs.Id] = cs
+	}
+	waiting := 0
+	for _, c := range r.clients {
+		cs, ok := clients[c.spec.Id]
+		if ok != c.registered {
+			return false
+		}
+		if !ok {
+			if c.waiting() != 0 {
+				return false // its dropped chunk is yet to be reported
+			}
+			continue
+		}
+		if cs.InFlight != c.running || cs.Waiting != c.waiting() {
+			return false
+		}
+		waiting += cs.Waiting
+	}
+	return waiting == 0 || status.InFlight == int(status.MaxParallel)
+}
+
+// next returns the first client whose produced chunk the Balancer would take, nil if there's none, r.mu must be held.
+func (r *run) next() *client {
+	for _, c := range r.clients {
+		if c.registered && c.available && c.waiting() == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// offer hands the produced chunk of c to the Balancer. It's called with r.mu held and releases it.
+func (r *run) offer(c *client) error {
+	c.available = false
+	c.taken++
+	c.readyAt = r.clock.Now()
+	if c.remaining > 0 {
+		c.remaining--
+	}
+	r.changes++
+	r.produce(c)
+	now := r.clock.Now()
+	r.mu.Unlock()
+
+	timeout := time.NewTimer(settleTimeout)
+	defer timeout.Stop()
+	select {
+	case c.workload <- &chunk{client: c}:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("at %v the Balancer didn't take a chunk of the client %d in %v", now, c.spec.Id, settleTimeout)
+	}
+}
+
+func (r *run) arrive(c *client) {
+	registration, err := r.b.Register(context.Background(), c, balancer.OnResult(r.result))
+	if err != nil {
+		r.err = err
+		return
+	}
+	c.registration, c.registered = registration, true
+	r.changes++
+	r.produce(c)
+}
+
+// produce makes the next chunk of c available after its interval, if it has one.
+func (r *run) produce(c *client) {
+	if c.remaining == 0 {
+		return
+	}
+	if c.spec.Interval == 0 {
+		c.available = true
+		return
+	}
+	r.clock.After(c.spec.Interval, func() { c.available = true })
+}
+
+func (r *run) leave(c *client) {
+	if !c.registered {
+		return
+	}
+	c.registered = false
+	c.registration.Deregister()
+	r.changes++
+}
+
+// result counts the chunks dropped by the Balancer.
+func (r *run) result(result balancer.Result[*chunk, struct{}]) {
+	if !errors.Is(result.Err, balancer.ErrDropped) {
+		return
+	}
+	r.mu.Lock()
+	result.Chunk.client.dropped++
+	r.changes++
+	r.mu.Unlock()
+}
+
+// server processes the chunks of a run in virtual time.
+type server struct {
+	r *run
+}
+
+func (s server) Process(_ context.Context, ch *chunk) (struct{}, error) {
+	r, c := s.r, ch.client
+	r.mu.Lock()
+	r.running++
+	if r.running > r.peak {
+		r.peak = r.running
+	}
+	if r.running > r.s.MaxParallel && r.err == nil {
+		r.err = fmt.Errorf("%w: at %v %d chunks processed in parallel, at most %d allowed", ErrInvariant,
+			r.clock.Now(), r.running, r.s.MaxParallel)
+	}
+	c.running++
+	c.started++
+	wait := r.clock.Now() - c.readyAt
+	c.wait += wait
+	if wait > c.maxWait {
+		c.maxWait = wait
+	}
+	r.changes++
+	done := make(chan struct{})
+	r.clock.After(c.spec.Latency.Sample(r.latencies), func() {
+		r.complete(c)
+		close(done)
+	})
+	r.mu.Unlock()
+
+	var err error
+	select {
+	case <-done:
+	case <-r.stop:
+		err = errStopped
+	}
+	r.mu.Lock()
+	if err == nil {
+		r.returning--
+	}
+	r.running--
+	c.running--
+	r.changes++
+	r.mu.Unlock()
+	return struct{}{}, err
+}
+
+// complete counts a processed chunk of c. A client with no more chunks is deregistered with its last one, when the
+// Balancer would remove it if it closed its workload, r.mu must be held.
+func (r *run) complete(c *client) {
+	c.completed++
+	c.finished = r.clock.Now()
+	r.returning++
+	if c.registered && c.remaining == 0 && c.waiting() == 0 && c.running == 1 {
+		c.registered = false
+		c.registration.Deregister()
+		r.changes++
+	}
+}
+
+// account integrates the state of the run over d, r.mu must be held.
+func (r *run) account(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	seconds := d.Seconds()
+	backlogWeight := 0
+	for _, c := range r.clients {
+		if c.registered && c.waiting() > 0 {
+			backlogWeight += c.spec.Weight
+		}
+	}
+	for _, c := range r.clients {
+		if c.registered && c.waiting() > 0 {
+			c.backlogged += seconds
+			c.received += float64(c.running) * seconds
+			c.entitled += float64(r.s.MaxParallel) * float64(c.spec.Weight) / float64(backlogWeight) * seconds
+		}
+	}
+	// with a chunk waiting all slots should be used, otherwise only those processing chunks can be
+	r.used += float64(r.running) * seconds
+	if backlogWeight > 0 {
+		r.demanded += float64(r.s.MaxParallel) * seconds
+	} else {
+		r.demanded += float64(r.running) * seconds
+	}
+}
@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	var c Clock
+	var order []string
+	c.At(20, func() { order = append(order, "b") })
+	c.At(10, func() {
+		order = append(order, "a")
+		c.After(0, func() { order = append(order, "a+0") })
+		c.After(10, func() { order = append(order, "a+10") })
+	})
+	for c.Step() {
+	}
+	if expected := []string{"a", "a+0", "b", "a+10"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("ran %v, expected %v", order, expected)
+	}
+	if c.Now() != 20 {
+		t.Errorf("clock at %v", c.Now())
+	}
+}
+
+func TestAllScenarios(t *testing.T) {
+	for name, s := range Scenarios() {
+		reports, err := Compare(s, Policies())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range reports {
+			if r.PeakInFlight > s.MaxParallel || r.Utilisation < 0.999 {
+				t.Errorf("%s with %s: peak %d, utilisation %.3f", name, r.Policy, r.PeakInFlight, r.Utilisation)
+			}
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	s := Scenarios()["churn"]
+	random := Policies()[4]
+	first, err := Run(s, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Run(s, random)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("runs differ:\n%+v\n%+v", first, second)
+	}
+	s.Seed++
+	if third, _ := Run(s, random); reflect.DeepEqual(first, third) {
+		t.Error("another seed gives the same run")
+	}
+}
+
+func TestDocScenario(t *testing.T) {
+	started := time.Now()
+	r, err := Run(Scenarios()["doc"], Policies()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(started); took > 3*time.Second {
+		t.Errorf("simulating %v took %v", r.Elapsed, took)
+	}
+	if r.Fairness < 0.99 {
+		t.Errorf("fairness %.3f", r.Fairness)
+	}
+	for _, c := range r.Clients {
+		if c.Completed == 0 || math.Abs(c.Received-c.Entitled) > 1 {
+			t.Errorf("client %d: %+v", c.Id, c)
+		}
+	}
+	// the heavy client finishes first: 3000 chunks at 50 slots and 10ms take about 0.6s
+	if heavy := r.Clients[2]; heavy.Finished > 700*time.Millisecond || heavy.Finished > r.Clients[0].Finished {
+		t.Errorf("the heavy client finished at %v", heavy.Finished)
+	}
+}
+
+func TestFairness(t *testing.T) {
+	s := Scenarios()["churn"]
+	reports, err := Compare(s, Policies())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fairness := map[string]float64{}
+	for _, r := range reports {
+		fairness[r.Policy] = r.Fairness
+	}
+	for _, fair := range []string{"slot-share", "wfq"} {
+		if fairness[fair] < 0.98 {
+			t.Errorf("%s fairness %.3f", fair, fairness[fair])
+		}
+	}
+	// round robin ignores the weights, strict priority starves the light clients
+	for _, unfair := range []string{"round-robin", "strict-priority"} {
+		if fairness[unfair] > fairness["slot-share"] {
+			t.Errorf("%s fairness %.3f above slot-share %.3f", unfair, fairness[unfair], fairness["slot-share"])
+		}
+	}
+
+	var out strings.Builder
+	if err := WriteReports(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 1+len(reports)*len(s.Clients) {
+		t.Errorf("report of %d lines:\n%s", lines, out.String())
+	}
+}
+
+func TestInvariant(t *testing.T) {
+	// a Balancer with more slots than the server takes
+	s := Scenarios()["doc"]
+	if _, err := simulate(s, Policies()[0], s.MaxParallel+1); !errors.Is(err, ErrInvariant) {
+		t.Errorf("expected a violated invariant, got %v", err)
+	}
+}
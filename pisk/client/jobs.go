@@ -15,6 +15,11 @@ type APIClient struct {
 	urlBase string
 }
 
+// NewAPIClient creates a client of the piskvorky API at urlBase, e.g. a local tournament server.
+func NewAPIClient(urlBase string) APIClient {
+	return APIClient{urlBase}
+}
+
 type User struct {
 	UserId    string `json:"userId"`
 	UserToken string `json:"userToken"`
@@ -142,6 +147,9 @@ func (r *RemotePlay) LoadCredentialsFromConfigFile(filename string) error {
 	r.user.UserToken = configuration["userToken"]
 	r.game.GameId = configuration["gameId"]
 	r.game.GameToken = configuration["gameToken"]
+	if url, ok := configuration["url"]; ok { // play elsewhere than piskvorky.jobs.cz
+		r.apiClient.urlBase = url
+	}
 
 	log.Println("Loaded credentials from config file", r.user.UserId, r.user.UserToken, r.game.GameId, r.game.GameToken)
 	return nil
@@ -1,5 +1,15 @@
 module martinp/piskvorky
 
-go 1.16
+go 1.21
 
-require github.com/apibillme/restly v0.0.0-20181130043549-213f75e88fab // indirect
+require github.com/apibillme/restly v0.0.0-20181130043549-213f75e88fab
+
+require (
+	github.com/beevik/etree v1.0.1 // indirect
+	github.com/klauspost/compress v1.4.0 // indirect
+	github.com/klauspost/cpuid v0.0.0-20180405133222-e7e905edc00e // indirect
+	github.com/tidwall/gjson v1.1.3 // indirect
+	github.com/tidwall/match v1.0.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.0.0 // indirect
+)
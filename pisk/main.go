@@ -2,10 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"martinp/piskvorky/client"
 	"martinp/piskvorky/pisk"
+	"martinp/piskvorky/tournament"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -43,36 +48,70 @@ func printMatches(threats []pisk.PatternMatch, player uint8) {
 
 var strategy pisk.Depth1Strategy = pisk.Depth1Strategy{}
 
+// setupTracing configures the engine from the environment: PISK_LOG sets the log level
+// (debug, info, warn, error) of engine logging to stderr and PISK_TRACE names a file that
+// receives a JSON search report for every computer move. Both are off by default.
+func setupTracing() {
+	if level := os.Getenv("PISK_LOG"); level != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			log.Fatalf("invalid PISK_LOG: %v", err)
+		}
+		strategy.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: l}))
+	}
+	if filename := os.Getenv("PISK_TRACE"); filename != "" {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("failed to open trace file: %v", err)
+		}
+		strategy.Tracer = pisk.NewJSONTracer(f)
+	}
+}
+
+// coaching replaces the raw pattern dumps by advice in words and warns before losing moves.
+var coaching bool
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] \n", question)
+	reader := bufio.NewReader(os.Stdin)
+	text, _ := reader.ReadString('\n')
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(text)), "y")
+}
+
 func interactiveGameRound(game *pisk.Game, player uint8) (bool, uint8) {
 	game.Board.Print()
-	threats := game.Board.SearchThreats(pisk.ThreatPatterns, player)
-	printMatches(threats, player)
-	threats = game.Board.SearchThreats(pisk.ThreatPatterns, 1-player)
-	printMatches(threats, 1-player)
-	move, score := strategy.NextMove(&game.Board, player)
-	//move, score := strategy.AttackMove(&game.Board, player)
-	fmt.Printf("Computer move: %v, score: %v\n", move, score)
+	if coaching {
+		fmt.Println(pisk.Coach(&game.Board, player))
+	} else {
+		threats := game.Board.SearchThreats(game.Board.Rules().Patterns, player)
+		printMatches(threats, player)
+		threats = game.Board.SearchThreats(game.Board.Rules().Patterns, 1-player)
+		printMatches(threats, 1-player)
+		if game.Board.Rules().OneStonePerTurn() { // the strategy doesn't see the second stone of a turn
+			move, score := strategy.NextMove(&game.Board, player)
+			//move, score := strategy.AttackMove(&game.Board, player)
+			fmt.Printf("Computer move: %v, score: %v\n", move, score)
+		}
+	}
 
 	for {
 		move := readMoveFromInput(player)
+		if coaching && game.Board.IsEmpty(move.X, move.Y) {
+			if reply, lost := pisk.ForcedLoss(&game.Board, player, move); lost &&
+				!confirm(fmt.Sprintf("Careful, after this move your opponent wins by playing %v %v. Play it anyway?", reply.X, reply.Y)) {
+				continue
+			}
+		}
 		if game.Play(move, player) {
 			break
 		}
 		fmt.Println("Invalid move:", move)
 	}
 
-	if player == 0 {
-		if game.Board.XWon() {
-			game.Board.Print()
-			fmt.Println("X won!")
-			return true, 0
-		}
-	} else {
-		if game.Board.OWon() {
-			game.Board.Print()
-			fmt.Println("O won!")
-			return true, 1
-		}
+	if result := game.Result(); result.Finished() {
+		game.Board.Print()
+		fmt.Println("Game over:", result)
+		return true, uint8(result.Winner())
 	}
 	return false, 0
 }
@@ -95,11 +134,255 @@ func loadCredentials(rp *client.RemotePlay) {
 	}
 }
 
+// selfPlay plays Depth1Strategy against MCTSStrategy, alternating colours, and prints the score.
+// The games are saved in ./games for training. With a weights file MCTS evaluates its playouts
+// by the learned model.
+func selfPlay(games int, weights string) {
+	var evaluator pisk.Evaluator
+	if weights != "" {
+		model, err := pisk.LoadLogisticModel(weights)
+		if err != nil {
+			log.Fatalf("failed to load weights: %v", err)
+		}
+		evaluator = model
+	}
+
+	var wins [2]int // depth1, mcts
+	draws := 0
+	for i := 0; i < games; i++ {
+		mcts := pisk.NewMCTSStrategy()
+		mcts.TimeLimit = time.Second
+		mcts.Evaluator = evaluator
+		mcts.Logger = strategy.Logger
+		mcts.Tracer = strategy.Tracer
+
+		var winner int
+		var game *pisk.Game
+		if i%2 == 0 {
+			game, winner = pisk.SelfPlay(strategy, mcts, boardSize, 300)
+		} else {
+			game, winner = pisk.SelfPlay(mcts, strategy, boardSize, 300)
+			if winner >= 0 {
+				winner = 1 - winner
+			}
+		}
+		if winner < 0 {
+			draws++
+		} else {
+			wins[winner]++
+		}
+		fmt.Printf("Game %v: %v moves, depth1 %v, mcts %v, draws %v\n", i+1, len(game.Log.Moves), wins[0], wins[1], draws)
+		game.Log.SaveToFile(fmt.Sprintf("./games/selfplay-%v-%v.log", time.Now().Unix(), i))
+	}
+}
+
+// train fits the learned evaluation to the outcomes of the saved games and writes the weights.
+func train(weights string, files []string) {
+	var samples []pisk.Sample
+	for _, filename := range files {
+		gameLog := pisk.NewGameLog(true)
+		gameLog.LoadFromFile(filename)
+		gameSamples, err := pisk.SamplesFromLog(gameLog, boardSize)
+		if err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+		samples = append(samples, gameSamples...)
+	}
+	fmt.Printf("%v positions from %v games\n", len(samples), len(files))
+
+	model, err := pisk.TrainLogistic(samples, 2000, 0.1, 0.001)
+	if err != nil {
+		log.Fatalf("training failed: %v", err)
+	}
+	fmt.Printf("Log loss: %.4f\n", model.LogLoss(samples))
+	if err := model.SaveToFile(weights); err != nil {
+		log.Fatalf("failed to save weights: %v", err)
+	}
+	fmt.Printf("Weights saved in %s.\n", weights)
+}
+
+// serve runs a tournament server for bots, see package tournament.
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "listen address")
+	format := flags.String("format", string(tournament.FormatRoundRobin), "round-robin or swiss")
+	rounds := flags.Int("rounds", 5, "number of Swiss rounds")
+	timeControl := flags.String("time", "5m0s+2s/30s", "time control: initial+increment/perMove")
+	stateFile := flags.String("state", "./tournament.json", "players and leaderboard")
+	adminToken := flags.String("admin-token", "", "token required to start a tournament")
+	flags.Parse(args)
+	if f := tournament.Format(*format); f != tournament.FormatRoundRobin && f != tournament.FormatSwiss {
+		fmt.Fprintf(flags.Output(), "invalid -format %q: must be round-robin or swiss\n", *format)
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	tc, err := pisk.ParseTimeControl(*timeControl)
+	if err != nil {
+		log.Fatalf("invalid time control: %v", err)
+	}
+	server, err := tournament.NewServer(tournament.Config{
+		Format:      tournament.Format(*format),
+		Rounds:      *rounds,
+		TimeControl: tc,
+		StateFile:   *stateFile,
+		GamesDir:    "./games",
+		AdminToken:  *adminToken,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	go server.WatchClocks(context.Background(), time.Second)
+	log.Println("Tournament server listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
+
+// replay steps through a saved game, or exports it as an animated GIF or PNG images.
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	gifFile := flags.String("gif", "", "export the game as an animated GIF to this file")
+	pngDir := flags.String("png", "", "export an image of every move to this directory")
+	cell := flags.Int("cell", 20, "pixels per square of the exported images")
+	delay := flags.Duration("delay", 500*time.Millisecond, "time between the moves of the GIF")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("usage: replay [-gif file] [-png dir] [-cell n] [-delay d] <game.log>")
+	}
+	if *cell < pisk.MinCell {
+		log.Fatalf("-cell must be at least %d pixels", pisk.MinCell)
+	}
+
+	gameLog := pisk.NewGameLog(true)
+	gameLog.LoadFromFile(flags.Arg(0))
+	r, err := pisk.NewReplay(gameLog, boardSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *gifFile != "" || *pngDir != "" {
+		if *gifFile != "" {
+			f, err := os.Create(*gifFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := r.WriteGIF(f, *cell, *delay); err != nil {
+				log.Fatalf("failed to write %s: %v", *gifFile, err)
+			}
+			f.Close()
+			fmt.Printf("Game saved in %s.\n", *gifFile)
+		}
+		if *pngDir != "" {
+			if err := os.MkdirAll(*pngDir, 0755); err != nil {
+				log.Fatal(err)
+			}
+			files, err := r.SavePNGs(*pngDir, *cell)
+			if err != nil {
+				log.Fatalf("failed to save images: %v", err)
+			}
+			fmt.Printf("%d images saved in %s.\n", len(files), *pngDir)
+		}
+		return
+	}
+
+	fmt.Printf("X: %s, O: %s, %s\n", gameLog.Players[0], gameLog.Players[1], gameLog.Result)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		printReplay(r)
+		fmt.Println("[enter] next, [b] back, [number] jump to move, [q] quit")
+		if !scanner.Scan() {
+			return
+		}
+		command := strings.TrimSpace(scanner.Text())
+		switch command {
+		case "", "n":
+			if !r.Forward() {
+				fmt.Println("End of the game.")
+			}
+		case "b", "p":
+			if !r.Back() {
+				fmt.Println("Start of the game.")
+			}
+		case "q":
+			return
+		default:
+			ply, err := strconv.Atoi(command)
+			if err != nil || !r.Seek(ply) {
+				fmt.Printf("Invalid move number %q, the game has %d moves.\n", command, r.Len())
+			}
+		}
+	}
+}
+
+func printReplay(r *pisk.Replay) {
+	gb := r.Board()
+	gb.Print()
+	if move, player, ok := r.LastMove(); ok {
+		fmt.Printf("Move %d of %d: player %d played %d %d", r.Ply(), r.Len(), player, move.X, move.Y)
+		if r.Ply() <= len(r.Log.Times) {
+			fmt.Printf(" in %v", r.Log.Times[r.Ply()-1])
+		}
+		fmt.Println()
+	} else {
+		fmt.Printf("Start of the game, %d moves\n", r.Len())
+	}
+	for player, threats := range r.Threats() {
+		printMatches(threats, uint8(player))
+	}
+}
+
 func main() {
 	var game *pisk.Game
 	loadedMoves := 0
+	setupTracing()
 
-	if len(os.Args) == 3 && os.Args[1] == "load" {
+	if (len(os.Args) == 3 || len(os.Args) == 4) && os.Args[1] == "selfplay" {
+		games, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			log.Fatalf("invalid number of games: %v", err)
+		}
+		weights := ""
+		if len(os.Args) == 4 {
+			weights = os.Args[3]
+		}
+		selfPlay(games, weights)
+		os.Exit(0)
+	} else if len(os.Args) >= 2 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+	} else if len(os.Args) >= 2 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		os.Exit(0)
+	} else if len(os.Args) >= 4 && os.Args[1] == "train" {
+		train(os.Args[2], os.Args[3:])
+		os.Exit(0)
+	} else if len(os.Args) == 2 && os.Args[1] == "coach" {
+		fmt.Println("New local game with coaching")
+		coaching = true
+		game = pisk.NewGame(boardSize, true)
+	} else if len(os.Args) == 3 && os.Args[1] == "coach" {
+		fmt.Println("Loading game with coaching from ", os.Args[2])
+		coaching = true
+		game = pisk.NewGame(boardSize, true)
+		loadedMoves = game.LoadFromFile(os.Args[2])
+		if rules := game.Board.Rules(); !rules.OneStonePerTurn() {
+			fmt.Printf("No coaching for %s, it places more stones per turn\n", rules.Name)
+			coaching = false
+		}
+	} else if (len(os.Args) == 3 || len(os.Args) == 4) && os.Args[1] == "variant" {
+		rules, err := pisk.RulesByName(os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		size := uint8(boardSize)
+		if len(os.Args) == 4 {
+			n, err := strconv.ParseUint(os.Args[3], 10, 8)
+			if err != nil || n < uint64(rules.WinLength) || n > boardSize {
+				log.Fatalf("invalid board size: %v", os.Args[3])
+			}
+			size = uint8(n)
+		}
+		fmt.Printf("New local game of %s on %dx%d\n", rules.Name, size, size)
+		game = pisk.NewGameWithRules(size, rules)
+	} else if len(os.Args) == 3 && os.Args[1] == "load" {
 		fmt.Println("Loading game from ", os.Args[2])
 		game = pisk.NewGame(boardSize, true)
 		loadedMoves = game.LoadFromFile(os.Args[2])
@@ -144,12 +427,10 @@ func main() {
 		}
 	}()
 
-	var player uint8 = game.Log.NextPlayer()
 	for {
-		win, _ := interactiveGameRound(game, player)
+		win, _ := interactiveGameRound(game, game.NextPlayer())
 		if win {
 			break
 		}
-		player = 1 - player
 	}
 }
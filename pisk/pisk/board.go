@@ -22,11 +22,20 @@ func NewBoard(size uint8) Board {
 }
 
 func (b *Board) Won() bool {
+	return b.WonWith(WinningPattern)
+}
+
+// WonWith reports whether the winning pattern is found in any line of the board.
+func (b *Board) WonWith(winning Pattern) bool {
 	for i := uint8(0); i < b.size; i++ {
-		if WinningPattern.Match(b.vertical[i]) ||
-			WinningPattern.Match(b.horizontal[i]) ||
-			WinningPattern.Match(b.mainDiagonal[i]) ||
-			WinningPattern.Match(b.antiDiagonal[i]) {
+		if winning.Match(b.vertical[i]) ||
+			winning.Match(b.horizontal[i]) {
+			return true
+		}
+	}
+	for i := range b.mainDiagonal { // there are 2*size-1 diagonals in each direction
+		if winning.Match(b.mainDiagonal[i]) ||
+			winning.Match(b.antiDiagonal[i]) {
 			return true
 		}
 	}
@@ -89,6 +98,19 @@ func (b *Board) Unplace(x, y uint8) {
 	b.antiDiagonal[x-y+b.size-1] &= ^(uint64(1) << x)
 }
 
+// offDiagonal returns the bits of the diagonal i, in either direction, that are off the board. The
+// diagonal holds the bits of the columns max(0, i-size+1) to min(i, size-1).
+func (b *Board) offDiagonal(i uint8) uint64 {
+	first, last := 0, int(i)
+	if last >= int(b.size) {
+		first, last = int(i)-int(b.size)+1, int(b.size)-1
+	}
+	if first > last {
+		return ^uint64(0)
+	}
+	return ^(uint64(1)<<(last+1) - uint64(1)<<first)
+}
+
 func (b *Board) Taken(x, y uint8) bool {
 	return b.vertical[y]&(1<<x) != 0
 }
@@ -0,0 +1,253 @@
+package pisk
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// The bitboard views are checked against a plain set of stones and the pattern matching against
+// naive scanners that work on coordinates only.
+
+type stones map[Move]bool
+
+// checkViews verifies that all four bitboards of b hold exactly the stones in want.
+func checkViews(t *testing.T, b *Board, want stones) {
+	t.Helper()
+	var counts [4]int
+	for y := uint8(0); y < b.size; y++ {
+		for x := uint8(0); x < b.size; x++ {
+			views := [4]bool{
+				b.vertical[y]&(1<<x) != 0,
+				b.horizontal[x]&(1<<y) != 0,
+				b.mainDiagonal[x+y]&(1<<x) != 0,
+				b.antiDiagonal[x-y+b.size-1]&(1<<x) != 0,
+			}
+			for i, v := range views {
+				if v != want[Move{x, y}] {
+					t.Fatalf("%v view at (%v, %v) is %v, expected %v", directionName(uint8(i)), x, y, v, want[Move{x, y}])
+				}
+			}
+		}
+	}
+	for i, view := range [][]uint64{b.vertical, b.horizontal, b.mainDiagonal, b.antiDiagonal} {
+		for _, bits := range view {
+			for ; bits != 0; bits &= bits - 1 {
+				counts[i]++
+			}
+		}
+		if counts[i] != len(want) {
+			t.Fatalf("%v view has %v stones, expected %v", directionName(uint8(i)), counts[i], len(want))
+		}
+	}
+}
+
+// runBoardOps interprets data as a sequence of (op, x, y) triples applied to a board and a set.
+func runBoardOps(t *testing.T, size uint8, data []byte) {
+	b := NewBoard(size)
+	want := stones{}
+	for i := 0; i+2 < len(data); i += 3 {
+		x, y := data[i+1]%size, data[i+2]%size
+		switch data[i] % 4 {
+		case 0, 1:
+			b.Place(x, y)
+			want[Move{x, y}] = true
+		case 2:
+			b.Unplace(x, y)
+			delete(want, Move{x, y})
+		case 3:
+			b = b.Copy()
+		}
+		if b.Taken(x, y) != want[Move{x, y}] {
+			t.Fatalf("Taken(%v, %v) is %v", x, y, b.Taken(x, y))
+		}
+	}
+	checkViews(t, &b, want)
+}
+
+// naiveWon looks for five in a row in every direction from every stone.
+func naiveWon(size uint8, want stones) bool {
+	for m := range want {
+		for _, d := range [4][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+			n := 0
+			for x, y := int(m.X), int(m.Y); want[Move{uint8(x), uint8(y)}] && x >= 0 && y >= 0 && x < int(size) && y < int(size); x, y = x+d[0], y+d[1] {
+				n++
+			}
+			if n >= 5 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lineCells returns the coordinates of the bits of line index in direction, indexed by bit.
+// Bits that fall off the board are marked invalid.
+func lineCells(size uint8, direction uint8, index int) (cells [64]Move, valid [64]bool) {
+	for bit := 0; bit < int(size); bit++ {
+		var x, y int
+		switch direction {
+		case 0: // vertical[y] holds bit x
+			x, y = bit, index
+		case 1: // horizontal[x] holds bit y
+			x, y = index, bit
+		case 2: // mainDiagonal[x+y] holds bit x
+			x, y = bit, index-bit
+		case 3: // antiDiagonal[x-y+size-1] holds bit x
+			x, y = bit, bit-index+int(size)-1
+		}
+		if x >= 0 && y >= 0 && x < int(size) && y < int(size) {
+			cells[bit] = Move{uint8(x), uint8(y)}
+			valid[bit] = true
+		}
+	}
+	return
+}
+
+// naiveSearchThreats finds the first shift of every pattern on every line like SearchThreats.
+// Squares off the board count as occupied, as SearchThreats masks them.
+func naiveSearchThreats(size uint8, patterns []Pattern, own, other stones) []PatternMatch {
+	var results []PatternMatch
+	for _, p := range patterns {
+		for i := 0; i < int(size); i++ {
+			for _, line := range [][2]int{{0, i}, {1, i}, {2, i}, {3, i}, {2, i + int(size)}, {3, i + int(size)}} {
+				cells, valid := lineCells(size, uint8(line[0]), line[1])
+				for shift := 0; shift < int(p.NShifts); shift++ {
+					match := true
+					for bit := 0; bit < 64 && match; bit++ {
+						wantOwn := p.Pat>>bit&1 == 1
+						wantSpace := p.Space>>bit&1 == 1
+						if !wantOwn && !wantSpace {
+							continue
+						}
+						at := shift + bit
+						isOwn := at < 64 && valid[at] && own[cells[at]]
+						isOther := at < 64 && valid[at] && other[cells[at]]
+						offBoard := at < 64 && !valid[at]
+						if (wantOwn && !isOwn) || (wantSpace && (isOwn || isOther || offBoard)) {
+							match = false
+						}
+					}
+					if match {
+						results = append(results, PatternMatch{p, uint8(line[1]), uint8(shift), uint8(line[0])})
+						break
+					}
+				}
+			}
+		}
+	}
+	return results
+}
+
+func sameMatches(a, b []PatternMatch) bool {
+	count := map[[5]uint64]int{}
+	for _, m := range a {
+		count[[5]uint64{m.Pat, m.Space, uint64(m.Index), uint64(m.Shift), uint64(m.Direction)}]++
+	}
+	for _, m := range b {
+		count[[5]uint64{m.Pat, m.Space, uint64(m.Index), uint64(m.Shift), uint64(m.Direction)}]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// placeStones fills a game board from data, every byte pair is a stone, alternating X and O.
+func placeStones(size uint8, data []byte) (GameBoard, [2]stones) {
+	gb := NewGameBoard(size)
+	placed := [2]stones{{}, {}}
+	for i := 0; i+1 < len(data); i += 2 {
+		m := Move{data[i] % size, data[i+1] % size}
+		if gb.IsEmpty(m.X, m.Y) {
+			player := uint8(i / 2 % 2)
+			gb.Place(m.X, m.Y, player)
+			placed[player][m] = true
+		}
+	}
+	return gb, placed
+}
+
+func checkWon(t *testing.T, size uint8, data []byte) {
+	b := NewBoard(size)
+	want := stones{}
+	for i := 0; i+1 < len(data); i += 2 {
+		m := Move{data[i] % size, data[i+1] % size}
+		b.Place(m.X, m.Y)
+		want[m] = true
+	}
+	if b.Won() != naiveWon(size, want) {
+		t.Fatalf("Won() is %v on a board of size %v with %v", b.Won(), size, want)
+	}
+}
+
+func checkSearchThreats(t *testing.T, size uint8, data []byte) {
+	gb, placed := placeStones(size, data)
+	for player := uint8(0); player < 2; player++ {
+		got := gb.SearchThreats(ThreatPatterns, player)
+		want := naiveSearchThreats(size, ThreatPatterns, placed[player], placed[1-player])
+		if !sameMatches(got, want) {
+			t.Fatalf("player %v: SearchThreats found %v, expected %v", player, got, want)
+		}
+	}
+}
+
+func fuzzSize(b byte) uint8 {
+	return 5 + b%28 // 5..32
+}
+
+func FuzzBoardOps(f *testing.F) {
+	f.Add(byte(27), []byte{0, 31, 0, 0, 0, 31, 2, 31, 0, 3, 0, 0})
+	f.Add(byte(0), []byte{0, 4, 0, 1, 0, 4, 3, 0, 0, 2, 0, 4})
+	f.Fuzz(func(t *testing.T, size byte, data []byte) {
+		runBoardOps(t, fuzzSize(size), data)
+	})
+}
+
+func FuzzWon(f *testing.F) {
+	f.Add(byte(27), []byte{27, 31, 28, 30, 29, 29, 30, 28, 31, 27}) // anti-diagonal in the corner
+	f.Add(byte(27), []byte{27, 5, 28, 5, 29, 5, 30, 5, 31, 5})      // row at the right edge
+	f.Fuzz(func(t *testing.T, size byte, data []byte) {
+		checkWon(t, fuzzSize(size), data)
+	})
+}
+
+func FuzzSearchThreats(f *testing.F) {
+	f.Add(byte(27), []byte{1, 1, 10, 10, 2, 2, 11, 1, 3, 3, 12, 2, 4, 4, 13, 3})
+	f.Fuzz(func(t *testing.T, size byte, data []byte) {
+		checkSearchThreats(t, fuzzSize(size), data)
+	})
+}
+
+func randomBytes(rng *rand.Rand, n int) []byte {
+	data := make([]byte, rng.Intn(n))
+	rng.Read(data)
+	return data
+}
+
+func TestBoardProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		size := fuzzSize(byte(rng.Intn(256)))
+		runBoardOps(t, size, randomBytes(rng, 600))
+		checkWon(t, size, randomBytes(rng, 120))
+		checkSearchThreats(t, size, randomBytes(rng, 160))
+	}
+}
+
+func TestWonDiagonals(t *testing.T) {
+	// fives along every diagonal and at every edge must be found
+	for x := uint8(0); x+4 < 32; x++ {
+		for y := uint8(0); y+4 < 32; y += 9 {
+			main := []byte{}
+			anti := []byte{}
+			for k := uint8(0); k < 5; k++ {
+				main = append(main, x+k, y+k)
+				anti = append(anti, x+k, y+4-k)
+			}
+			checkWon(t, 32, main)
+			checkWon(t, 32, anti)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package pisk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeControl is a Fischer time control: each player starts with Initial time and gets Increment
+// added after every move. PerMove, when set, also limits the time spent on a single move.
+// With more stones per turn a move is the whole turn. The zero value means an untimed game.
+type TimeControl struct {
+	Initial   time.Duration
+	Increment time.Duration
+	PerMove   time.Duration
+}
+
+func (tc TimeControl) IsZero() bool {
+	return tc == TimeControl{}
+}
+
+// String returns the time control as "initial+increment/perMove", e.g. "5m0s+2s/30s".
+func (tc TimeControl) String() string {
+	if tc.IsZero() {
+		return ""
+	}
+	s := fmt.Sprintf("%v+%v", tc.Initial, tc.Increment)
+	if tc.PerMove > 0 {
+		s += "/" + tc.PerMove.String()
+	}
+	return s
+}
+
+// ParseTimeControl parses the format of TimeControl.String. The increment and the per move limit
+// are optional, "" is an untimed game.
+func ParseTimeControl(s string) (TimeControl, error) {
+	var tc TimeControl
+	var err error
+	if s == "" {
+		return tc, nil
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		if tc.PerMove, err = time.ParseDuration(s[i+1:]); err != nil {
+			return tc, fmt.Errorf("invalid per move limit: %w", err)
+		}
+		s = s[:i]
+	}
+	if i := strings.Index(s, "+"); i >= 0 {
+		if tc.Increment, err = time.ParseDuration(s[i+1:]); err != nil {
+			return tc, fmt.Errorf("invalid increment: %w", err)
+		}
+		s = s[:i]
+	}
+	if tc.Initial, err = time.ParseDuration(s); err != nil {
+		return tc, fmt.Errorf("invalid initial time: %w", err)
+	}
+	return tc, nil
+}
+
+// Clock keeps the remaining time of both players under a TimeControl.
+type Clock struct {
+	Control   TimeControl
+	Remaining [2]time.Duration
+	Now       func() time.Time // nil for time.Now, replaceable in tests
+
+	running     bool
+	player      uint8
+	turnStarted time.Time
+}
+
+func NewClock(tc TimeControl) *Clock {
+	return &Clock{
+		Control:   tc,
+		Remaining: [2]time.Duration{tc.Initial, tc.Initial},
+	}
+}
+
+func (c *Clock) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// Start starts the turn of player.
+func (c *Clock) Start(player uint8) {
+	c.running = true
+	c.player = player
+	c.turnStarted = c.now()
+}
+
+func (c *Clock) Running() bool {
+	return c.running
+}
+
+// Stop ends the turn of player and returns the time spent on it. It returns false if the player
+// ran out of time or exceeded the per move limit, otherwise the increment is added.
+func (c *Clock) Stop(player uint8) (time.Duration, bool) {
+	spent := c.Elapsed(player)
+	c.running = false
+	c.Remaining[player] -= spent
+	if c.Remaining[player] < 0 || (c.Control.PerMove > 0 && spent > c.Control.PerMove) {
+		return spent, false
+	}
+	c.Remaining[player] += c.Control.Increment
+	return spent, true
+}
+
+// Elapsed returns the time player has spent on the running turn, 0 if it isn't their turn.
+func (c *Clock) Elapsed(player uint8) time.Duration {
+	if !c.running || c.player != player {
+		return 0
+	}
+	return c.now().Sub(c.turnStarted)
+}
+
+// Flagged reports whether player is out of time on the running turn.
+func (c *Clock) Flagged(player uint8) bool {
+	spent := c.Elapsed(player)
+	return spent > c.Remaining[player] || (c.Control.PerMove > 0 && spent > c.Control.PerMove)
+}
@@ -0,0 +1,201 @@
+package pisk
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Advice explains a position to a human player in words.
+type Advice struct {
+	Threats     []string // the opponent's threats, the worst first
+	Defenses    []Move   // squares that defend against the worst threat
+	Attack      Move     // our best attacking move
+	AttackScore uint8
+	AttackPlan  string // what the attacking move creates
+}
+
+// String returns the advice as lines of text.
+func (a Advice) String() string {
+	var lines []string
+	if len(a.Threats) == 0 {
+		lines = append(lines, "Your opponent has no threats.")
+	} else {
+		lines = append(lines, "Your opponent threatens:")
+		for _, t := range a.Threats {
+			lines = append(lines, "  - "+t)
+		}
+		if len(a.Defenses) > 0 {
+			lines = append(lines, "You can defend the worst threat at "+squares(a.Defenses)+".")
+		}
+	}
+	if a.AttackScore > 0 {
+		lines = append(lines, fmt.Sprintf("Best attack: %v, %s.", square(a.Attack), a.AttackPlan))
+	} else {
+		lines = append(lines, "There's no attacking move, build up your stones.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Coach explains the position of player: the opponent's threats with their defenses, and our
+// best attacking move. The advice is for rules of one stone per turn, see Rules.OneStonePerTurn.
+func Coach(gb *GameBoard, player uint8) Advice {
+	var advice Advice
+
+	threats := gb.SearchThreats(gb.rules.Patterns, 1-player)
+	sort.SliceStable(threats, func(i, j int) bool { return threats[i].Pattern.Value > threats[j].Pattern.Value })
+	for i, threat := range threats {
+		advice.Threats = append(advice.Threats, gb.rules.DescribeMatch(&threat, gb.size))
+		if i == 0 {
+			advice.Defenses = threat.Defense(gb.size)
+		}
+	}
+
+	advice.Attack, advice.AttackScore = Depth1Strategy{}.AttackMove(gb, player)
+	if advice.AttackScore > 0 {
+		advice.AttackPlan = attackPlan(gb, player, advice.Attack)
+	}
+	return advice
+}
+
+// attackPlan describes the best threat that playing move creates.
+func attackPlan(gb *GameBoard, player uint8, move Move) string {
+	board := gb.Copy()
+	board.Place(move.X, move.Y, player)
+	var best *PatternMatch
+	for _, match := range board.SearchThreats(board.rules.Patterns, player) {
+		match := match
+		if containsMove(match.Squares(gb.size), move) && (best == nil || match.Pattern.Value > best.Pattern.Value) {
+			best = &match
+		}
+	}
+	if best == nil {
+		return "it strengthens your position"
+	}
+	plan := "it makes " + gb.rules.DescribeMatch(best, gb.size)
+	switch {
+	case best.Pattern.Value == MaxValue:
+		plan += " and wins"
+	case best.Pattern.Value >= MustDefend:
+		plan += " that your opponent must block"
+	}
+	return plan
+}
+
+var numberNames = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+
+func numberName(n int) string {
+	if n < len(numberNames) {
+		return numberNames[n]
+	}
+	return fmt.Sprint(n)
+}
+
+// ThreatName names the shape of a pattern by the stones it has relative to WinLength, in gomoku:
+// five, open four, four, open three or broken three.
+func (r Rules) ThreatName(p Pattern) string {
+	k := int(r.WinLength)
+	stones := bits.OnesCount64(p.Pat)
+	contiguous := p.Pat>>bits.TrailingZeros64(p.Pat) == 1<<stones-1
+	switch {
+	case stones >= k:
+		return numberName(stones)
+	case stones == k-1 && bits.OnesCount64(p.Space) >= 2:
+		return "open " + numberName(stones)
+	case stones == k-1:
+		return numberName(stones)
+	case stones == k-2 && contiguous:
+		return "open " + numberName(stones)
+	case stones == k-2:
+		return "broken " + numberName(stones)
+	default:
+		return fmt.Sprintf("%d stones", stones)
+	}
+}
+
+var lineNames = []string{"row", "column", "diagonal", "diagonal"}
+
+// DescribeMatch describes a pattern match in words, e.g. "an open four in a row at (3,5) (4,5) ...".
+func (r Rules) DescribeMatch(pm *PatternMatch, boardSize uint8) string {
+	name := r.ThreatName(pm.Pattern)
+	article := "a"
+	if strings.IndexAny(name[:1], "aeiou") == 0 {
+		article = "an"
+	}
+	return fmt.Sprintf("%s %s in a %s at %s", article, name, lineNames[pm.Direction], squares(pm.Squares(boardSize)))
+}
+
+// ForcedLoss reports whether playing move lets the opponent win by force within their next two
+// moves: either they complete a row at once, or their answer makes two threats of completing one
+// that can't both be blocked, like an open four in gomoku, while player has no row of their own to
+// complete. It returns the opponent's winning answer. With more stones per turn it never reports a
+// loss, the threats can't be counted one stone at a time.
+func ForcedLoss(gb *GameBoard, player uint8, move Move) (Move, bool) {
+	if !gb.rules.OneStonePerTurn() {
+		return Move{}, false
+	}
+	board := gb.Copy()
+	board.Place(move.X, move.Y, player)
+	if board.Wins(move.X, move.Y, player) {
+		return Move{}, false
+	}
+	if _, ok := completingSquare(&board, player); ok {
+		return Move{}, false // we threaten to win, the opponent has to answer
+	}
+	if win, ok := completingSquare(&board, 1-player); ok {
+		return win, true
+	}
+
+	for _, reply := range board.PossibleMoves() {
+		after := board.Copy()
+		after.Place(reply.X, reply.Y, 1-player)
+		if len(completingSquares(&after, 1-player)) >= 2 {
+			return reply, true
+		}
+	}
+	return Move{}, false
+}
+
+// completingSquare returns a square where player completes a winning row.
+func completingSquare(gb *GameBoard, player uint8) (Move, bool) {
+	squares := completingSquares(gb, player)
+	if len(squares) == 0 {
+		return Move{}, false
+	}
+	return squares[0], true
+}
+
+// completingSquares returns the distinct empty squares where player completes a winning row.
+func completingSquares(gb *GameBoard, player uint8) []Move {
+	var squares []Move
+	for _, threat := range gb.SearchThreats(gb.rules.UrgentPatterns(), player) {
+		for _, move := range threat.Defense(gb.size) {
+			if move.X < gb.size && move.Y < gb.size && gb.IsEmpty(move.X, move.Y) && !containsMove(squares, move) {
+				squares = append(squares, move)
+			}
+		}
+	}
+	return squares
+}
+
+func containsMove(moves []Move, move Move) bool {
+	for _, m := range moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+func square(m Move) string {
+	return fmt.Sprintf("(%d,%d)", m.X, m.Y)
+}
+
+func squares(moves []Move) string {
+	names := make([]string, len(moves))
+	for i, m := range moves {
+		names[i] = square(m)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,70 @@
+package pisk_test
+
+import (
+	"martinp/piskvorky/pisk"
+	"strings"
+	"testing"
+)
+
+func TestThreatName(t *testing.T) {
+	names := []string{"open three", "open three", "broken three", "broken three", "open four", "four", "four", "five"}
+	for i, p := range pisk.ThreatPatterns {
+		if name := pisk.Gomoku.ThreatName(p); name != names[i] {
+			t.Errorf("pattern %b: %q, expected %q", p.Pat, name, names[i])
+		}
+	}
+
+	names = []string{"open four", "open five", "five", "five", "five", "five", "five", "five", "six"}
+	for i, p := range pisk.Connect6.Patterns {
+		if name := pisk.Connect6.ThreatName(p); name != names[i] {
+			t.Errorf("connect6 pattern %b: %q, expected %q", p.Pat, name, names[i])
+		}
+	}
+	if name := pisk.TicTacToe.ThreatName(pisk.TicTacToe.Patterns[0]); name != "open two" {
+		t.Errorf("tic-tac-toe pattern: %q", name)
+	}
+}
+
+func TestCoach(t *testing.T) {
+	game := pisk.NewGame(32, true)
+	// O has an open three in row 5, X is to move
+	game.LoadFromArray([]pisk.Move{{20, 20}, {10, 5}, {21, 22}, {11, 5}, {25, 25}, {12, 5}})
+
+	advice := pisk.Coach(&game.Board, 0)
+	if len(advice.Threats) == 0 || advice.Threats[0] != "an open three in a row at (10,5) (11,5) (12,5)" {
+		t.Errorf("unexpected threats %q", advice.Threats)
+	}
+	if len(advice.Defenses) == 0 || !strings.Contains(advice.String(), "You can defend the worst threat at") {
+		t.Errorf("no defense in %q", advice.String())
+	}
+
+	if reply, lost := pisk.ForcedLoss(&game.Board, 0, pisk.Move{X: 2, Y: 2}); !lost || (reply != pisk.Move{X: 13, Y: 5} && reply != pisk.Move{X: 9, Y: 5}) {
+		t.Errorf("ignoring the open three isn't a forced loss: %v, %v", reply, lost)
+	}
+	if reply, lost := pisk.ForcedLoss(&game.Board, 0, pisk.Move{X: 13, Y: 5}); lost {
+		t.Errorf("blocking the open three is a forced loss after %v", reply)
+	}
+}
+
+func TestCoachAttack(t *testing.T) {
+	game := pisk.NewGame(32, true)
+	// X has four in a row 10 blocked on the left, X is to move
+	game.LoadFromArray([]pisk.Move{{10, 10}, {9, 10}, {11, 10}, {20, 20}, {12, 10}, {21, 21}, {13, 10}, {25, 21}})
+
+	advice := pisk.Coach(&game.Board, 0)
+	if advice.Attack != (pisk.Move{X: 14, Y: 10}) || !strings.Contains(advice.AttackPlan, "five") {
+		t.Errorf("unexpected attack %v: %q", advice.Attack, advice.AttackPlan)
+	}
+}
+
+func TestCoachConnect6(t *testing.T) {
+	if !pisk.Gomoku.OneStonePerTurn() || pisk.Connect6.OneStonePerTurn() {
+		t.Fatal("unexpected stones per turn")
+	}
+	game := pisk.NewGameWithRules(19, pisk.Connect6)
+	// O has five in row 5 blocked on the left, X blocks it with the second stone of its turn
+	game.LoadFromArray([]pisk.Move{{9, 9}, {5, 5}, {6, 5}, {4, 5}, {16, 16}, {7, 5}, {8, 5}, {15, 15}, {16, 15}, {9, 5}, {0, 0}})
+	if reply, lost := pisk.ForcedLoss(&game.Board, 0, pisk.Move{X: 1, Y: 1}); lost {
+		t.Errorf("a loss counted one stone at a time after %v", reply)
+	}
+}
@@ -1,15 +1,20 @@
 package pisk
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"time"
 )
 
 const MaxValue = 255
 const MustDefend = 100
 
-type Depth1Strategy struct{}
+// Depth1Strategy plays the best attack or defends the worst threat found one move ahead, as if
+// every turn was one stone (see Rules.OneStonePerTurn). It is silent unless Logger or Tracer is set.
+type Depth1Strategy struct {
+	Logger *slog.Logger
+	Tracer Tracer
+}
 
 var ThreatPatterns []Pattern = []Pattern{
 	{
@@ -71,9 +76,15 @@ var ThreatPatterns []Pattern = []Pattern{
 }
 
 func (s Depth1Strategy) AttackMove(gb *GameBoard, player uint8) (Move, uint8) {
+	return s.attackMove(gb, player, &SearchReport{})
+}
+
+// attackMove is AttackMove recording the evaluated moves as candidates of report.
+func (s Depth1Strategy) attackMove(gb *GameBoard, player uint8, report *SearchReport) (Move, uint8) {
+	logger := loggerOrSilent(s.Logger)
 	moves := gb.PossibleMoves()
 	//moves := []Move{{7, 4}}
-	fmt.Printf("Possible move for player %v : %v\n", player, moves)
+	logger.Debug("possible moves", "player", player, "moves", len(moves))
 	if len(moves) == 0 {
 		return Move{gb.size / 2, gb.size / 2}, 0
 	}
@@ -88,20 +99,21 @@ func (s Depth1Strategy) AttackMove(gb *GameBoard, player uint8) (Move, uint8) {
 		testGb.Place(move.X, move.Y, player)
 		//testGb.Print()
 
-		matches := testGb.SearchThreats(ThreatPatterns, player)
+		matches := testGb.SearchThreats(gb.rules.Patterns, player)
 		bestValue = 0
 		for _, match := range matches {
-			match.Print()
+			logger.Debug("match", "move", move, "match", match)
 			if match.Pattern.Value > bestValue {
 				bestValue = match.Pattern.Value
 			}
 			score = bestValue
 		}
+		report.Candidates = append(report.Candidates, CandidateScore{Move: move, Score: float64(bestValue)})
 
 		if score > bestScore {
 			bestScore = score
 			bestMove = move
-			fmt.Println("bestMove: ", bestMove, bestScore)
+			logger.Debug("best move", "move", bestMove, "score", bestScore)
 			if score == MaxValue { // no point searching further
 				return bestMove, bestScore
 			}
@@ -114,21 +126,33 @@ func (s Depth1Strategy) AttackMove(gb *GameBoard, player uint8) (Move, uint8) {
 	}
 
 	// FIXME: We would like a better naive selection here, such as playon on a diagonal.
-	fmt.Println("No attack move found, returning random move")
+	logger.Debug("no attack move found, returning random move")
 	return moves[rand.Intn(len(moves))], 0
 }
 
 func (s Depth1Strategy) NextMove(gb *GameBoard, player uint8) (Move, uint8) {
-	attackMove, attackScore := s.AttackMove(gb, player)
+	started := time.Now()
+	report := &SearchReport{Strategy: "depth1", Player: player}
+	move, score := s.nextMove(gb, player, report)
+	report.Move, report.Score = move, score
+	finishReport(loggerOrSilent(s.Logger), s.Tracer, report, started)
+	return move, score
+}
+
+func (s Depth1Strategy) nextMove(gb *GameBoard, player uint8, report *SearchReport) (Move, uint8) {
+	logger := loggerOrSilent(s.Logger)
+	attackMove, attackScore := s.attackMove(gb, player, report)
 	if attackScore == MaxValue {
+		report.Reason = "winning move"
 		return attackMove, MaxValue // the winning move, no thinking needed
 	}
 	//threats := []PatternMatch{} // gb.SearchThreats(ThreatPatterns, player)
 	b := gb.Copy() // copy should not be necessary, but it is --> there's a bug in the searchThreats function
-	threats := b.SearchThreats(ThreatPatterns, 1-player)
-	fmt.Printf("Threats by player %v : %v\n", 1-player, len(threats))
+	threats := b.SearchThreats(gb.rules.Patterns, 1-player)
+	report.Threats = len(threats)
+	logger.Debug("threats", "player", 1-player, "count", len(threats))
 	for _, t := range threats {
-		t.Print()
+		logger.Debug("threat", "player", 1-player, "match", t)
 	}
 
 	/* Evaluate threats */
@@ -149,8 +173,9 @@ func (s Depth1Strategy) NextMove(gb *GameBoard, player uint8) (Move, uint8) {
 
 				// There should be only one defensive move here.
 				if len(defensiveMoves) != 1 {
-					log.Println("Error: number of defensiveMoves is not 1")
+					logger.Error("number of defensiveMoves is not 1", "moves", defensiveMoves)
 				}
+				report.Reason = "defend five"
 				return defensiveMoves[rand.Intn(len(defensiveMoves))], MaxValue
 			}
 		}
@@ -162,13 +187,19 @@ func (s Depth1Strategy) NextMove(gb *GameBoard, player uint8) (Move, uint8) {
 	// FIXME: we should consider all threats of the same value and find a common defense if it exists.
 	// We should also consider the attack value of the defensive move.
 	defensiveMoves = worstThreat.Defense(gb.size)
-	fmt.Println("defensiveMoves: ", defensiveMoves)
+	logger.Debug("defensive moves", "moves", defensiveMoves)
 
 	if attackScore == MaxValue || (attackScore > defenseValue && defenseValue < MustDefend) || len(defensiveMoves) == 0 {
 		// our attack has higher value than the worst threat, so we will play it
+		if attackScore > 0 {
+			report.Reason = "attack outweighs the worst threat"
+		} else {
+			report.Reason = "random move, no attack or threat"
+		}
 		return attackMove, attackScore
 	} else {
 		// goint to play a defensive move that prevents a threat of a highter value that is the best value of our move
+		report.Reason = "defend the worst threat"
 		return defensiveMoves[rand.Intn(len(defensiveMoves))], defenseValue
 	}
 }
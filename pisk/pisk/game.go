@@ -1,44 +1,169 @@
 package pisk
 
+import (
+	"log"
+	"time"
+)
+
 type Game struct {
 	Log   *GameLog
 	Board GameBoard
+	Clock *Clock // nil for an untimed game
+
+	turnSpent time.Duration // logged for the stones of the running turn
 }
 
 func NewGame(boardSize uint8, xstarts bool) *Game {
-	return &Game{
+	game := &Game{
 		Log:   NewGameLog(xstarts),
 		Board: NewGameBoard(boardSize),
 	}
+	game.Log.BoardSize = boardSize
+	return game
+}
+
+// NewGameWithRules creates a game of another k-in-a-row variant than gomoku.
+func NewGameWithRules(boardSize uint8, rules Rules) *Game {
+	game := NewGame(boardSize, true)
+	game.Board = NewGameBoardWithRules(boardSize, rules)
+	if rules.Name != Gomoku.Name {
+		game.Log.Rules = rules.Name
+	}
+	return game
+}
+
+// NewTimedGame creates a game between named players (X first) played under a time control.
+func NewTimedGame(boardSize uint8, players [2]string, tc TimeControl) *Game {
+	game := NewGame(boardSize, true)
+	game.Log.Players = players
+	game.Log.TimeControl = tc
+	if !tc.IsZero() {
+		game.Clock = NewClock(tc)
+	}
+	return game
 }
 
+// Result returns the result of the game, Unfinished while it's being played.
+func (g *Game) Result() Result {
+	return g.Log.Result
+}
+
+// NextPlayer returns the player to place the next stone. With more stones per turn the same
+// player places several stones in a row.
+func (g *Game) NextPlayer() uint8 {
+	return g.Board.rules.PlayerOfMove(len(g.Log.Moves))
+}
+
+// Play places the move of player. It returns false if the move is invalid, it isn't the player's
+// turn or the game is over. In a timed game the time of the move is charged to player; a move
+// made too late loses the game on time and isn't played. With more stones per turn the clock runs
+// for the whole turn: the increment is added and the opponent's clock started with its last stone.
 func (g *Game) Play(move Move, player uint8) bool {
+	if g.Log.Result.Finished() || player != g.NextPlayer() {
+		return false
+	}
 	if move.X >= g.Board.size || move.Y >= g.Board.size {
 		return false
 	}
 	if !g.Board.IsEmpty(move.X, move.Y) {
 		return false
 	}
-	g.Log.Add(move)
+
+	if g.Clock != nil {
+		if !g.Clock.Running() { // the first move starts the clock
+			g.Clock.Start(player)
+		}
+		var spent time.Duration
+		var ok bool
+		endsTurn := g.Board.rules.PlayerOfMove(len(g.Log.Moves)+1) != player
+		if endsTurn {
+			spent, ok = g.Clock.Stop(player)
+		} else {
+			spent, ok = g.Clock.Elapsed(player), !g.Clock.Flagged(player)
+		}
+		if !ok {
+			g.Log.Result = WinResult(1-player, ReasonTime)
+			return false
+		}
+		g.Log.AddTimed(move, spent-g.turnSpent)
+		g.turnSpent = spent
+		if endsTurn {
+			g.turnSpent = 0
+		}
+	} else {
+		g.Log.Add(move)
+	}
 	g.Board.Place(move.X, move.Y, player)
+
+	if g.Board.Wins(move.X, move.Y, player) {
+		reason := ReasonFive
+		if g.Board.rules.WinLength != 5 {
+			reason = ReasonRow
+		}
+		g.Log.Result = WinResult(player, reason)
+	} else if len(g.Log.Moves) == int(g.Board.size)*int(g.Board.size) {
+		g.Log.Result = Result{Draw, ReasonFullBoard}
+	} else if g.Clock != nil && !g.Clock.Running() {
+		g.Clock.Start(g.NextPlayer())
+	}
+	return true
+}
+
+// Resign ends the game with a loss of player.
+func (g *Game) Resign(player uint8) {
+	if !g.Log.Result.Finished() {
+		g.Log.Result = WinResult(1-player, ReasonResignation)
+	}
+}
+
+// CheckTime ends the game if player, who is to move, has run out of time. It returns true if so.
+func (g *Game) CheckTime(player uint8) bool {
+	if g.Clock == nil || g.Log.Result.Finished() || !g.Clock.Flagged(player) {
+		return false
+	}
+	g.Log.Result = WinResult(1-player, ReasonTime)
 	return true
 }
 
+// LoadFromFile replaces the game with the one saved in filename, on the board size of the log if it
+// records it.
 func (g *Game) LoadFromFile(filename string) int {
+	size := g.Board.size
 	g.Log.LoadFromFile(filename)
-	var player uint8 = 0
-	for _, move := range g.Log.Moves {
-		g.Board.Place(move.X, move.Y, player)
-		player = 1 - player
+	if g.Log.BoardSize != 0 {
+		size = g.Log.BoardSize
+	}
+	rules, err := RulesByName(g.Log.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.Board = NewGameBoardWithRules(size, rules)
+	for i, move := range g.Log.Moves {
+		g.Board.Place(move.X, move.Y, rules.PlayerOfMove(i))
+	}
+	g.Clock, g.turnSpent = nil, 0
+	if tc := g.Log.TimeControl; !tc.IsZero() {
+		g.Clock = NewClock(tc)
+		var turn time.Duration
+		for i, spent := range g.Log.Times {
+			player := rules.PlayerOfMove(i)
+			turn += spent
+			if rules.PlayerOfMove(i+1) != player { // the last stone of the turn
+				g.Clock.Remaining[player] += tc.Increment - turn
+				turn = 0
+			}
+		}
+		// the stones of an unfinished turn are charged without the increment
+		if turn > 0 {
+			g.Clock.Remaining[rules.PlayerOfMove(len(g.Log.Times)-1)] -= turn
+		}
 	}
 	return len(g.Log.Moves)
 }
 
 func (g *Game) LoadFromArray(moves []Move) int {
-	var player uint8
 	for _, move := range moves {
-		g.Play(move, player)
-		player = 1 - player
+		g.Play(move, g.NextPlayer())
 	}
 	return len(g.Log.Moves)
 }
@@ -2,25 +2,54 @@ package pisk
 
 import (
 	"fmt"
+	"math/bits"
 	"strconv"
 )
 
 type GameBoard struct {
 	size      uint8
+	rules     Rules
 	XBoard    Board
 	OBoard    Board
 	nextMoves Board
 }
 
 func NewGameBoard(size uint8) GameBoard {
+	return NewGameBoardWithRules(size, Gomoku)
+}
+
+func NewGameBoardWithRules(size uint8, rules Rules) GameBoard {
 	return GameBoard{
 		size:      size,
+		rules:     rules,
 		XBoard:    NewBoard(size),
 		OBoard:    NewBoard(size),
 		nextMoves: NewBoard(size),
 	}
 }
 
+func (gb *GameBoard) Size() uint8 {
+	return gb.size
+}
+
+func (gb *GameBoard) Rules() Rules {
+	return gb.rules
+}
+
+// Stones returns the number of stones on the board.
+func (gb *GameBoard) Stones() int {
+	n := 0
+	for y := uint8(0); y < gb.size; y++ {
+		n += bits.OnesCount64(gb.XBoard.vertical[y] | gb.OBoard.vertical[y])
+	}
+	return n
+}
+
+// Wins reports whether the stone of player at x, y completes a winning row.
+func (gb *GameBoard) Wins(x, y uint8, player uint8) bool {
+	return inRow(playerBoard(gb, player), x, y, gb.rules.WinLength)
+}
+
 func (gb *GameBoard) IsEmpty(x, y uint8) bool {
 	return gb.XBoard.IsEmpty(x, y) && gb.OBoard.IsEmpty(x, y)
 }
@@ -45,11 +74,11 @@ func (gb *GameBoard) PossibleMoves() []Move {
 }
 
 func (gb *GameBoard) XWon() bool {
-	return gb.XBoard.Won()
+	return gb.XBoard.WonWith(gb.rules.WinningPattern())
 }
 
 func (gb *GameBoard) OWon() bool {
-	return gb.OBoard.Won()
+	return gb.OBoard.WonWith(gb.rules.WinningPattern())
 }
 
 type PatternMatch struct {
@@ -76,28 +105,38 @@ func directionName(direction uint8) string {
 
 func (pm *PatternMatch) Defense(boardSize uint8) []Move {
 	var moves []Move = make([]Move, len(pm.Pattern.Defense))
+	for i, defense := range pm.Pattern.Defense {
+		moves[i] = pm.square(defense, boardSize)
+	}
+	return moves
+}
 
-	if pm.Direction == 0 { // vertical
-		for i, defense := range pm.Pattern.Defense {
-			moves[i] = Move{pm.Shift + defense, pm.Index}
-		}
-	} else if pm.Direction == 1 { // horizontal
-		for i, defense := range pm.Pattern.Defense {
-			moves[i] = Move{pm.Index, pm.Shift + defense}
-		}
-	} else if pm.Direction == 2 { // main diagonal
-		for i, defense := range pm.Pattern.Defense {
-			moves[i] = Move{pm.Shift + defense, -pm.Shift + pm.Index - defense}
-		}
-	} else if pm.Direction == 3 { // anti diagonal
-		for i, defense := range pm.Pattern.Defense {
-			// moves[i] = Move{pm.Shift + defense - pm.Index + boardSize - 1, pm.Shift + defense}
-			moves[i] = Move{pm.Shift + defense, pm.Shift + defense - pm.Index + boardSize - 1}
+// Squares returns the squares of the stones that make the pattern.
+func (pm *PatternMatch) Squares(boardSize uint8) []Move {
+	var moves []Move
+	for offset := uint8(0); pm.Pattern.Pat>>offset != 0; offset++ {
+		if pm.Pattern.Pat>>offset&1 == 1 {
+			moves = append(moves, pm.square(offset, boardSize))
 		}
 	}
 	return moves
 }
 
+// square returns the square at the bit offset within the matched pattern.
+func (pm *PatternMatch) square(offset uint8, boardSize uint8) Move {
+	switch pm.Direction {
+	case 0: // vertical
+		return Move{pm.Shift + offset, pm.Index}
+	case 1: // horizontal
+		return Move{pm.Index, pm.Shift + offset}
+	case 2: // main diagonal
+		return Move{pm.Shift + offset, -pm.Shift + pm.Index - offset}
+	default: // anti diagonal
+		// return Move{pm.Shift + offset - pm.Index + boardSize - 1, pm.Shift + offset}
+		return Move{pm.Shift + offset, pm.Shift + offset - pm.Index + boardSize - 1}
+	}
+}
+
 func (pm *PatternMatch) Print() {
 	fmt.Printf("Pattern: %v (%v), direction: %v, index: %v, shift: %v\n",
 		strconv.FormatUint(uint64(pm.Pattern.Pat), 2),
@@ -123,32 +162,39 @@ func (gb *GameBoard) SearchThreats(threats []Pattern, player uint8) []PatternMat
 		board2 = &gb.XBoard
 	}
 
+	// the squares off the board are occupied, so that they are neither open ends nor defenses
+	offRow := ^(uint64(1)<<gb.size - 1)
+	offDiagonal := make([]uint64, len(board1.mainDiagonal))
+	for i := range offDiagonal {
+		offDiagonal[i] = board1.offDiagonal(uint8(i))
+	}
+
 	for _, threat := range threats {
 		// fmt.Println("Searching threat:", threat)
 		for i := uint8(0); i < gb.size; i++ {
-			found, shift := threat.MatchWithSpace(board1.vertical[i], board2.vertical[i])
+			found, shift := threat.MatchWithSpace(board1.vertical[i], board2.vertical[i]|offRow)
 			if found {
 				results = append(results, PatternMatch{threat, i, shift, 0})
 			}
-			found, shift = threat.MatchWithSpace(board1.horizontal[i], board2.horizontal[i])
+			found, shift = threat.MatchWithSpace(board1.horizontal[i], board2.horizontal[i]|offRow)
 			if found {
 				results = append(results, PatternMatch{threat, i, shift, 1})
 			}
-			found, shift = threat.MatchWithSpace(board1.mainDiagonal[i], board2.mainDiagonal[i])
+			found, shift = threat.MatchWithSpace(board1.mainDiagonal[i], board2.mainDiagonal[i]|offDiagonal[i])
 			if found {
 				results = append(results, PatternMatch{threat, i, shift, 2})
 			}
-			found, shift = threat.MatchWithSpace(board1.antiDiagonal[i], board2.antiDiagonal[i])
+			found, shift = threat.MatchWithSpace(board1.antiDiagonal[i], board2.antiDiagonal[i]|offDiagonal[i])
 			if found {
 				results = append(results, PatternMatch{threat, i, shift, 3})
 			}
 
 			j := i + board1.size
-			found, shift = threat.MatchWithSpace(board1.mainDiagonal[j], board2.mainDiagonal[j])
+			found, shift = threat.MatchWithSpace(board1.mainDiagonal[j], board2.mainDiagonal[j]|offDiagonal[j])
 			if found {
 				results = append(results, PatternMatch{threat, j, shift, 2})
 			}
-			found, shift = threat.MatchWithSpace(board1.antiDiagonal[j], board2.antiDiagonal[j])
+			found, shift = threat.MatchWithSpace(board1.antiDiagonal[j], board2.antiDiagonal[j]|offDiagonal[j])
 			if found {
 				results = append(results, PatternMatch{threat, j, shift, 3})
 			}
@@ -158,7 +204,11 @@ func (gb *GameBoard) SearchThreats(threats []Pattern, player uint8) []PatternMat
 }
 
 func (gb *GameBoard) Print() {
-	fmt.Println(". 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1")
+	fmt.Print(".")
+	for j := uint8(0); j < gb.size; j++ {
+		fmt.Printf(" %v", j%10)
+	}
+	fmt.Println("")
 	for i := uint8(0); i < gb.size; i++ {
 		fmt.Printf("%v ", i%10)
 		for j := uint8(0); j < gb.size; j++ {
@@ -191,8 +241,8 @@ func (gb *GameBoard) Place(x, y uint8, player uint8) {
 		{x + 1, y + 1}, {x - 1, y - 1}, {x - 1, y + 1}, {x + 1, y - 1}}
 
 	for _, t := range tries {
-		if t[0] == 255 || t[1] == 255 {
-			continue // overflow
+		if t[0] >= gb.size || t[1] >= gb.size {
+			continue // off the board, x-1 or y-1 overflows to 255
 		}
 		if !gb.XBoard.Taken(t[0], t[1]) && !gb.OBoard.Taken(t[0], t[1]) {
 			gb.nextMoves.Place(t[0], t[1])
@@ -208,7 +258,7 @@ func (gb *GameBoard) Unplace(x uint8, y uint8) {
 
 func (gb *GameBoard) Copy() GameBoard {
 	//return NewGameBoard(gb.size)
-	return GameBoard{gb.size, gb.XBoard.Copy(), gb.OBoard.Copy(), gb.nextMoves.Copy()}
+	return GameBoard{gb.size, gb.rules, gb.XBoard.Copy(), gb.OBoard.Copy(), gb.nextMoves.Copy()}
 }
 
 /*
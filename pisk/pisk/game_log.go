@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Move struct {
@@ -14,9 +15,20 @@ type Move struct {
 	Y uint8
 }
 
+// GameLog is the record of a game. Besides the moves it keeps the players, the time control, the
+// time spent on each move, the result and the game and score of its match, saved as "# key: value" header lines.
 type GameLog struct {
-	XStarts bool
-	Moves   []Move
+	XStarts     bool
+	Moves       []Move
+	Times       []time.Duration // time spent on each stone, empty for untimed games
+	Players     [2]string       // X and O
+	Rules       string          // name of the Rules, empty for gomoku
+	BoardSize   uint8           // 0 if it isn't recorded
+	TimeControl TimeControl
+	Result      Result
+	Match       string     // e.g. "final game 2 of 5", empty outside of a Match
+	MatchGame   int        // number of the game in the Match from 1, 0 outside of a Match
+	MatchScore  [2]float64 // of the players of X and O in the Match before the game
 }
 
 func NewGameLog(xstarts bool) *GameLog {
@@ -30,6 +42,12 @@ func (gl *GameLog) Add(move Move) {
 	gl.Moves = append(gl.Moves, move)
 }
 
+// AddTimed adds a move made in spent time.
+func (gl *GameLog) AddTimed(move Move, spent time.Duration) {
+	gl.Moves = append(gl.Moves, move)
+	gl.Times = append(gl.Times, spent)
+}
+
 func (gl *GameLog) SaveToFile(filename string) {
 	f, err := os.Create(filename)
 	if err != nil {
@@ -37,9 +55,99 @@ func (gl *GameLog) SaveToFile(filename string) {
 	}
 	defer f.Close()
 
-	for _, move := range gl.Moves {
-		fmt.Fprintf(f, "%d %d\n", move.X, move.Y)
+	header := [][2]string{
+		{"x", gl.Players[0]},
+		{"o", gl.Players[1]},
+		{"rules", gl.Rules},
+		{"size", sizeHeader(gl.BoardSize)},
+		{"time-control", gl.TimeControl.String()},
+		{"match", gl.Match},
+	}
+	if gl.MatchGame > 0 {
+		header = append(header, [2]string{"match-game", strconv.Itoa(gl.MatchGame)},
+			[2]string{"match-score", scoreHeader(gl.MatchScore)})
 	}
+	if gl.Result.Finished() {
+		header = append(header, [2]string{"result", gl.Result.String()})
+	}
+	for _, h := range header {
+		if h[1] != "" {
+			fmt.Fprintf(f, "# %s: %s\n", h[0], h[1])
+		}
+	}
+
+	for i, move := range gl.Moves {
+		if i < len(gl.Times) {
+			fmt.Fprintf(f, "%d %d %v\n", move.X, move.Y, gl.Times[i])
+		} else {
+			fmt.Fprintf(f, "%d %d\n", move.X, move.Y)
+		}
+	}
+}
+
+func sizeHeader(size uint8) string {
+	if size == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(size))
+}
+
+// scoreHeader formats a match score like "1.5-0.5".
+func scoreHeader(score [2]float64) string {
+	return strconv.FormatFloat(score[0], 'f', -1, 64) + "-" + strconv.FormatFloat(score[1], 'f', -1, 64)
+}
+
+func parseScore(s string) ([2]float64, error) {
+	var score [2]float64
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return score, fmt.Errorf("invalid match score: %q", s)
+	}
+	for i, part := range parts {
+		var err error
+		if score[i], err = strconv.ParseFloat(part, 64); err != nil || score[i] < 0 {
+			return score, fmt.Errorf("invalid match score: %q", s)
+		}
+	}
+	return score, nil
+}
+
+// parseHeader reads a "# key: value" line, other comments are ignored.
+func (gl *GameLog) parseHeader(line string) error {
+	parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), ": ", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	var err error
+	switch parts[0] {
+	case "x":
+		gl.Players[0] = parts[1]
+	case "o":
+		gl.Players[1] = parts[1]
+	case "rules":
+		gl.Rules = parts[1]
+	case "size":
+		var n uint64
+		n, err = strconv.ParseUint(parts[1], 10, 8)
+		if err == nil && (n == 0 || n > 32) { // the patterns are 32 squares wide at most
+			err = fmt.Errorf("invalid board size: %d", n)
+		}
+		gl.BoardSize = uint8(n)
+	case "time-control":
+		gl.TimeControl, err = ParseTimeControl(parts[1])
+	case "match":
+		gl.Match = parts[1]
+	case "match-game":
+		gl.MatchGame, err = strconv.Atoi(parts[1])
+		if err == nil && gl.MatchGame < 1 {
+			err = fmt.Errorf("invalid match game: %d", gl.MatchGame)
+		}
+	case "match-score":
+		gl.MatchScore, err = parseScore(parts[1])
+	case "result":
+		gl.Result, err = ParseResult(parts[1])
+	}
+	return err
 }
 
 func (gl *GameLog) LoadFromFile(filename string) {
@@ -52,7 +160,10 @@ func (gl *GameLog) LoadFromFile(filename string) {
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "#") { // skip comments
+		if strings.HasPrefix(line, "#") { // header or comment
+			if err := gl.parseHeader(line); err != nil {
+				log.Fatal(err)
+			}
 			continue
 		}
 		parts := strings.Split(line, " ") // each line has "x y"
@@ -64,10 +175,24 @@ func (gl *GameLog) LoadFromFile(filename string) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		gl.Add(Move{uint8(x), uint8(y)})
+		if len(parts) > 2 {
+			spent, err := time.ParseDuration(parts[2])
+			if err != nil {
+				log.Fatal(err)
+			}
+			gl.AddTimed(Move{uint8(x), uint8(y)}, spent)
+		} else {
+			gl.Add(Move{uint8(x), uint8(y)})
+		}
 	}
 }
 
+// NextPlayer returns the player to place the next stone under the Rules of the game, taking turns
+// like in gomoku if they are unknown.
 func (gl *GameLog) NextPlayer() uint8 {
-	return uint8(len(gl.Moves) % 2)
+	rules, err := RulesByName(gl.Rules)
+	if err != nil {
+		rules = Gomoku
+	}
+	return rules.PlayerOfMove(len(gl.Moves))
 }
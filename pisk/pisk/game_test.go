@@ -0,0 +1,130 @@
+package pisk_test
+
+import (
+	"martinp/piskvorky/pisk"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeTime returns a clock function and a way to move it forward.
+func fakeTime() (func() time.Time, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestGameResult(t *testing.T) {
+	game := pisk.NewGame(32, true)
+	game.LoadFromArray([]pisk.Move{{3, 3}, {3, 4}, {4, 3}, {4, 4}, {5, 3}, {5, 4}, {6, 3}, {6, 4}, {7, 3}})
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.XWins, Reason: pisk.ReasonFive}) {
+		t.Errorf("unexpected result %v", r)
+	}
+	if game.Play(pisk.Move{X: 7, Y: 4}, 1) {
+		t.Error("move accepted after the end of the game")
+	}
+
+	game = pisk.NewGame(4, true)
+	var player uint8
+	for y := uint8(0); y < 4; y++ {
+		for x := uint8(0); x < 4; x++ {
+			game.Play(pisk.Move{X: x, Y: y}, player)
+			player = 1 - player
+		}
+	}
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.Draw, Reason: pisk.ReasonFullBoard}) {
+		t.Errorf("unexpected result on a full board %v", r)
+	}
+
+	game = pisk.NewGame(32, true)
+	game.Resign(1)
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.XWins, Reason: pisk.ReasonResignation}) {
+		t.Errorf("unexpected result after resignation %v", r)
+	}
+}
+
+func TestGameClock(t *testing.T) {
+	now, advance := fakeTime()
+	tc := pisk.TimeControl{Initial: 10 * time.Second, Increment: 2 * time.Second, PerMove: 8 * time.Second}
+	game := pisk.NewTimedGame(32, [2]string{"alice", "bob"}, tc)
+	game.Clock.Now = now
+
+	game.Play(pisk.Move{X: 10, Y: 10}, 0) // starts the clock
+	advance(5 * time.Second)
+	game.Play(pisk.Move{X: 11, Y: 11}, 1)
+	if game.Clock.Remaining != [2]time.Duration{12 * time.Second, 7 * time.Second} {
+		t.Errorf("unexpected remaining time %v", game.Clock.Remaining)
+	}
+
+	advance(7 * time.Second)
+	if game.CheckTime(0) {
+		t.Error("X flagged within the time")
+	}
+	game.Play(pisk.Move{X: 12, Y: 12}, 0)
+	beforeFlag := game.Clock.Remaining
+	advance(9 * time.Second)
+	if game.Play(pisk.Move{X: 13, Y: 13}, 1) {
+		t.Error("move over the per move limit accepted")
+	}
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.XWins, Reason: pisk.ReasonTime}) {
+		t.Errorf("unexpected result %v", r)
+	}
+
+	filename := filepath.Join(t.TempDir(), "game.log")
+	game.Log.SaveToFile(filename)
+	loaded := pisk.NewGame(32, true)
+	loaded.LoadFromFile(filename)
+	if loaded.Log.Players != game.Log.Players || loaded.Log.TimeControl != tc ||
+		loaded.Result() != game.Result() || len(loaded.Log.Times) != 3 || loaded.Log.Times[1] != 5*time.Second {
+		t.Errorf("loaded game differs: %+v != %+v", loaded.Log, game.Log)
+	}
+	if loaded.Clock.Remaining != beforeFlag { // the move made too late isn't recorded
+		t.Errorf("loaded clock differs: %v != %v", loaded.Clock.Remaining, beforeFlag)
+	}
+}
+
+func TestParseTimeControl(t *testing.T) {
+	for _, s := range []string{"", "5m0s+0s", "5m0s+2s", "1m0s+1s/10s"} {
+		tc, err := pisk.ParseTimeControl(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if tc.String() != s {
+			t.Errorf("%q parsed as %q", s, tc.String())
+		}
+	}
+	if _, err := pisk.ParseTimeControl("5 minutes"); err == nil {
+		t.Error("invalid time control accepted")
+	}
+}
+
+// scripted plays the next free square of its row, which is never blocked by the opponent.
+type scripted struct{ row uint8 }
+
+func (s scripted) NextMove(gb *pisk.GameBoard, player uint8) (pisk.Move, uint8) {
+	for x := uint8(0); ; x++ {
+		if gb.IsEmpty(x, s.row) {
+			return pisk.Move{X: x, Y: s.row}, 0
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	match := pisk.NewMatch("test", [2]string{"a", "b"}, 3, 32, pisk.TimeControl{})
+	// whoever plays X gets five first, so the players win one game each and the third decides
+	match.Play([2]pisk.Strategy{scripted{1}, scripted{2}}, 100)
+
+	if len(match.Games) != 3 || match.Score != [2]float64{2, 1} || match.Winner() != 0 {
+		t.Errorf("unexpected match: %v games, score %v, winner %v", len(match.Games), match.Score, match.Winner())
+	}
+	if match.Games[1].Log.Players != [2]string{"b", "a"} || match.Games[1].Log.Match != "test game 2 of 3" {
+		t.Errorf("colours didn't alternate: %+v", match.Games[1].Log)
+	}
+
+	// a won the first game, in the second it plays O
+	dir := t.TempDir()
+	match.SaveToDir(dir)
+	loaded := pisk.NewGameLog(true)
+	loaded.LoadFromFile(filepath.Join(dir, "test-2.log"))
+	if loaded.Match != "test game 2 of 3" || loaded.MatchGame != 2 || loaded.MatchScore != [2]float64{0, 1} {
+		t.Errorf("match not loaded: %q, game %d, score %v", loaded.Match, loaded.MatchGame, loaded.MatchScore)
+	}
+}
@@ -0,0 +1,170 @@
+package pisk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Evaluator scores a position for search. Evaluate returns the probability (0..1) that player,
+// who is to move, wins the game from gb.
+type Evaluator interface {
+	Evaluate(gb *GameBoard, player uint8) float64
+}
+
+// Features returns the pattern counts of gb seen by player: how many times each of ThreatPatterns
+// matches for player, followed by the same counts for the opponent.
+func Features(gb *GameBoard, player uint8) []float64 {
+	features := make([]float64, 2*len(ThreatPatterns))
+	for i, p := range []uint8{player, 1 - player} {
+		for _, match := range gb.SearchThreats(ThreatPatterns, p) {
+			for j, pattern := range ThreatPatterns {
+				if match.Pattern.Pat == pattern.Pat && match.Pattern.Space == pattern.Space {
+					features[i*len(ThreatPatterns)+j]++
+					break
+				}
+			}
+		}
+	}
+	return features
+}
+
+// Sample is one training position: its Features for the player to move and whether that player won.
+type Sample struct {
+	Features []float64
+	Won      float64
+}
+
+// SamplesFromLog returns the samples of a saved game, on its board if the log records the size and
+// on a board of boardSize otherwise. The Features are gomoku threats, so the log must be of gomoku.
+func SamplesFromLog(gl *GameLog, boardSize uint8) ([]Sample, error) {
+	if rules, err := RulesByName(gl.Rules); err != nil || rules.Name != Gomoku.Name {
+		return nil, fmt.Errorf("can't learn from a game of %q, only of gomoku", gl.Rules)
+	}
+	if gl.BoardSize != 0 {
+		boardSize = gl.BoardSize
+	}
+	return SamplesFromGame(boardSize, gl.Moves), nil
+}
+
+// SamplesFromGame replays the moves of a gomoku game (X first) and returns a sample for every
+// position of the game. Games without a winner teach nothing about the outcome, so they return no
+// samples.
+func SamplesFromGame(boardSize uint8, moves []Move) []Sample {
+	game := NewGame(boardSize, true)
+	var positions []GameBoard
+	winner := -1
+
+	var player uint8
+	for _, move := range moves {
+		if !game.Play(move, player) {
+			return nil
+		}
+		positions = append(positions, game.Board.Copy())
+		if game.Board.Wins(move.X, move.Y, player) {
+			winner = int(player)
+			break
+		}
+		player = 1 - player
+	}
+	if winner < 0 {
+		return nil
+	}
+
+	samples := make([]Sample, 0, len(positions))
+	for i := range positions {
+		toMove := uint8((i + 1) % 2)
+		var won float64
+		if int(toMove) == winner {
+			won = 1
+		}
+		samples = append(samples, Sample{Features(&positions[i], toMove), won})
+	}
+	return samples
+}
+
+// LogisticModel predicts the outcome of a position by logistic regression on its Features.
+type LogisticModel struct {
+	Weights []float64 `json:"weights"`
+	Bias    float64   `json:"bias"`
+}
+
+// TrainLogistic fits a LogisticModel to samples by batch gradient descent with L2 regularisation.
+func TrainLogistic(samples []Sample, epochs int, learningRate, l2 float64) (*LogisticModel, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no training samples")
+	}
+	n := len(samples[0].Features)
+	model := &LogisticModel{Weights: make([]float64, n)}
+
+	gradient := make([]float64, n)
+	for epoch := 0; epoch < epochs; epoch++ {
+		for i := range gradient {
+			gradient[i] = 0
+		}
+		var biasGradient float64
+		for _, sample := range samples {
+			err := model.Predict(sample.Features) - sample.Won
+			for i, f := range sample.Features {
+				gradient[i] += err * f
+			}
+			biasGradient += err
+		}
+		m := float64(len(samples))
+		for i := range model.Weights {
+			model.Weights[i] -= learningRate * (gradient[i]/m + l2*model.Weights[i])
+		}
+		model.Bias -= learningRate * biasGradient / m
+	}
+	return model, nil
+}
+
+// Predict returns the modelled probability of a win for the given features.
+func (m *LogisticModel) Predict(features []float64) float64 {
+	z := m.Bias
+	for i, f := range features {
+		z += m.Weights[i] * f
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+// LogLoss returns the mean cross-entropy of the model on samples, lower is better.
+func (m *LogisticModel) LogLoss(samples []Sample) float64 {
+	const eps = 1e-12
+	var loss float64
+	for _, sample := range samples {
+		p := m.Predict(sample.Features)
+		loss -= sample.Won*math.Log(p+eps) + (1-sample.Won)*math.Log(1-p+eps)
+	}
+	return loss / float64(len(samples))
+}
+
+// Evaluate implements Evaluator.
+func (m *LogisticModel) Evaluate(gb *GameBoard, player uint8) float64 {
+	return m.Predict(Features(gb, player))
+}
+
+func (m *LogisticModel) SaveToFile(filename string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// LoadLogisticModel reads weights saved by SaveToFile.
+func LoadLogisticModel(filename string) (*LogisticModel, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var model LogisticModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+	if len(model.Weights) != 2*len(ThreatPatterns) {
+		return nil, fmt.Errorf("%s: %d weights, expected %d", filename, len(model.Weights), 2*len(ThreatPatterns))
+	}
+	return &model, nil
+}
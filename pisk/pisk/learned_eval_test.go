@@ -0,0 +1,73 @@
+package pisk_test
+
+import (
+	"martinp/piskvorky/pisk"
+	"path/filepath"
+	"testing"
+)
+
+func TestSamplesFromGame(t *testing.T) {
+	// X wins with a horizontal five, O plays below
+	moves := []pisk.Move{{3, 3}, {3, 4}, {4, 3}, {4, 4}, {5, 3}, {5, 4}, {6, 3}, {10, 10}, {7, 3}}
+	samples := pisk.SamplesFromGame(32, moves)
+
+	if len(samples) != len(moves) {
+		t.Fatalf("expected %v samples, got %v", len(moves), len(samples))
+	}
+	for i, sample := range samples {
+		xToMove := i%2 == 1
+		if xToMove != (sample.Won == 1) {
+			t.Errorf("sample %v: wrong outcome %v", i, sample.Won)
+		}
+	}
+
+	if samples := pisk.SamplesFromGame(32, moves[:4]); len(samples) != 0 {
+		t.Errorf("unfinished game gave %v samples", len(samples))
+	}
+
+	game := pisk.NewGameWithRules(19, pisk.Connect6)
+	game.LoadFromArray(moves[:4])
+	if _, err := pisk.SamplesFromLog(game.Log, 32); err == nil {
+		t.Error("learned from a game of connect6")
+	}
+	game = pisk.NewGame(19, true)
+	game.LoadFromArray(moves)
+	if samples, err := pisk.SamplesFromLog(game.Log, 32); err != nil || len(samples) != len(moves) {
+		t.Errorf("%d samples of a gomoku log: %v", len(samples), err)
+	}
+}
+
+func TestTrainLogistic(t *testing.T) {
+	n := 2 * len(pisk.ThreatPatterns)
+	var samples []pisk.Sample
+	for i := 0; i < 50; i++ {
+		winning := make([]float64, n)
+		winning[4] = 1 // our open four
+		losing := make([]float64, n)
+		losing[len(pisk.ThreatPatterns)+4] = 1 // their open four
+		samples = append(samples, pisk.Sample{Features: winning, Won: 1}, pisk.Sample{Features: losing, Won: 0})
+	}
+
+	model, err := pisk.TrainLogistic(samples, 500, 0.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Weights[4] <= 0 || model.Weights[len(pisk.ThreatPatterns)+4] >= 0 {
+		t.Errorf("unexpected weights: %v", model.Weights)
+	}
+	if loss := model.LogLoss(samples); loss > 0.1 {
+		t.Errorf("log loss too high: %v", loss)
+	}
+
+	filename := filepath.Join(t.TempDir(), "weights.json")
+	if err := model.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := pisk.LoadLogisticModel(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Bias != model.Bias || loaded.Weights[4] != model.Weights[4] {
+		t.Errorf("loaded model differs: %v != %v", loaded, model)
+	}
+}
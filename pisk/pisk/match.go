@@ -0,0 +1,112 @@
+package pisk
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Match is a best-of-N series of games between two players who alternate colours, Players[0]
+// playing X in the first game. A win scores 1, a draw 0.5.
+type Match struct {
+	Name        string
+	Players     [2]string
+	BestOf      int
+	BoardSize   uint8
+	TimeControl TimeControl
+	Games       []*Game
+	Score       [2]float64
+}
+
+func NewMatch(name string, players [2]string, bestOf int, boardSize uint8, tc TimeControl) *Match {
+	return &Match{
+		Name:        name,
+		Players:     players,
+		BestOf:      bestOf,
+		BoardSize:   boardSize,
+		TimeControl: tc,
+	}
+}
+
+// Colour returns the colour (0 for X, 1 for O) of the player with index p in game number i.
+func (m *Match) Colour(i int, p int) uint8 {
+	return uint8(p ^ i%2)
+}
+
+// NextGame starts the next game of the match.
+func (m *Match) NextGame() *Game {
+	i := len(m.Games)
+	players := m.Players
+	if m.Colour(i, 0) == 1 {
+		players[0], players[1] = players[1], players[0]
+	}
+	game := NewTimedGame(m.BoardSize, players, m.TimeControl)
+	game.Log.Match = fmt.Sprintf("%s game %d of %d", m.Name, i+1, m.BestOf)
+	game.Log.MatchGame = i + 1
+	for p := range m.Players {
+		game.Log.MatchScore[m.Colour(i, p)] = m.Score[p]
+	}
+	m.Games = append(m.Games, game)
+	return game
+}
+
+// Record adds the result of the last game returned by NextGame to the score.
+func (m *Match) Record() {
+	i := len(m.Games) - 1
+	result := m.Games[i].Result()
+	switch result.Outcome {
+	case Draw:
+		m.Score[0] += 0.5
+		m.Score[1] += 0.5
+	case XWins, OWins:
+		for p := range m.Players {
+			if int(m.Colour(i, p)) == result.Winner() {
+				m.Score[p]++
+			}
+		}
+	}
+}
+
+// Finished reports whether a player has won the majority of games or all games were played.
+func (m *Match) Finished() bool {
+	half := float64(m.BestOf) / 2
+	return m.Score[0] > half || m.Score[1] > half || len(m.Games) >= m.BestOf
+}
+
+// Winner returns the index of the player who won the match, -1 for a tied or unfinished match.
+func (m *Match) Winner() int {
+	if !m.Finished() || m.Score[0] == m.Score[1] {
+		return -1
+	}
+	if m.Score[0] > m.Score[1] {
+		return 0
+	}
+	return 1
+}
+
+// Play plays the rest of the match, strategies[p] playing for Players[p]. A strategy that
+// returns an invalid move resigns, a game longer than maxMoves is a draw.
+func (m *Match) Play(strategies [2]Strategy, maxMoves int) {
+	for !m.Finished() {
+		i := len(m.Games)
+		game := m.NextGame()
+		for !game.Result().Finished() {
+			colour := game.NextPlayer()
+			if len(game.Log.Moves) >= maxMoves {
+				game.Log.Result = Result{Draw, ReasonMoveLimit}
+				break
+			}
+			move, _ := strategies[m.Colour(i, int(colour))].NextMove(&game.Board, colour)
+			if !game.Play(move, colour) && !game.Result().Finished() {
+				game.Resign(colour)
+			}
+		}
+		m.Record()
+	}
+}
+
+// SaveToDir saves the games of the match to dir, one file per game.
+func (m *Match) SaveToDir(dir string) {
+	for i, game := range m.Games {
+		game.Log.SaveToFile(filepath.Join(dir, fmt.Sprintf("%s-%d.log", m.Name, i+1)))
+	}
+}
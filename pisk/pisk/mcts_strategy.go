@@ -0,0 +1,414 @@
+package pisk
+
+import (
+	"log/slog"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultExploration  = 1.41 // ~sqrt(2), the textbook UCT constant
+	DefaultIterations   = 2000
+	DefaultPlayoutDepth = 30
+	DefaultPlayoutBias  = 0.7
+)
+
+// MCTSStrategy picks moves by Monte Carlo Tree Search (UCT). Playouts are biased by the threat
+// patterns of the board's rules: a playout always completes its own four or blocks the opponent's
+// four and otherwise prefers squares that make or defend smaller threats.
+//
+// The search tree is kept between calls to NextMove, so when the board grows by our move and the
+// opponent's answer the matching subtree becomes the new root. A strategy value must therefore
+// be used for one game at a time.
+type MCTSStrategy struct {
+	Exploration  float64       // UCT exploration constant
+	Iterations   int           // maximum number of playouts per move, 0 for DefaultIterations
+	TimeLimit    time.Duration // maximum time per move, 0 for no time limit
+	Workers      int           // number of parallel playout goroutines, 0 for runtime.NumCPU()
+	PlayoutDepth int           // moves played in a playout before it is scored as a draw
+	PlayoutBias  float64       // probability of a threat-guided playout move over a random one
+	Evaluator    Evaluator     // scores playouts cut off by PlayoutDepth, nil scores them as a draw
+	Logger       *slog.Logger  // nil for silent
+	Tracer       Tracer
+
+	mu     sync.Mutex
+	root   *mctsNode
+	rootGb GameBoard
+}
+
+type mctsNode struct {
+	move     Move
+	player   uint8 // the player who played move
+	stones   int   // stones on the board after move, decides who's to move
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []Move
+	visits   float64
+	wins     float64 // from the point of view of player
+	terminal bool    // move completed five in a row
+}
+
+func NewMCTSStrategy() *MCTSStrategy {
+	return &MCTSStrategy{
+		Exploration:  DefaultExploration,
+		Iterations:   DefaultIterations,
+		PlayoutDepth: DefaultPlayoutDepth,
+		PlayoutBias:  DefaultPlayoutBias,
+	}
+}
+
+func (s *MCTSStrategy) NextMove(gb *GameBoard, player uint8) (Move, uint8) {
+	moves := gb.PossibleMoves()
+	if len(moves) == 0 {
+		return Move{gb.size / 2, gb.size / 2}, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started := time.Now()
+	logger := loggerOrSilent(s.Logger)
+	s.reuseTree(gb, player, moves)
+	logger.Debug("search started", "player", player, "reusedVisits", s.root.visits)
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	iterations := s.Iterations
+	if iterations <= 0 {
+		iterations = DefaultIterations
+	}
+	var deadline time.Time
+	if s.TimeLimit > 0 {
+		deadline = time.Now().Add(s.TimeLimit)
+	}
+
+	// The tree is shared by all workers. Selection, expansion and backpropagation happen under
+	// treeMu, the playouts (where the time goes) run in parallel.
+	var treeMu sync.Mutex
+	var wg sync.WaitGroup
+	playouts := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			for {
+				treeMu.Lock()
+				if playouts >= iterations || (!deadline.IsZero() && time.Now().After(deadline)) {
+					treeMu.Unlock()
+					return
+				}
+				playouts++
+				node, board := s.selectAndExpand(rng)
+				treeMu.Unlock()
+
+				xScore := s.playout(&board, node, rng)
+
+				treeMu.Lock()
+				backpropagate(node, xScore)
+				treeMu.Unlock()
+			}
+		}(rand.New(rand.NewSource(rand.Int63())))
+	}
+	wg.Wait()
+
+	report := &SearchReport{Strategy: "mcts", Player: player}
+	for _, child := range s.root.children {
+		report.Candidates = append(report.Candidates, CandidateScore{
+			Move:   child.move,
+			Score:  child.wins / child.visits,
+			Visits: int(child.visits),
+		})
+	}
+
+	best := s.bestChild()
+	switch {
+	case best == nil:
+		report.Move, report.Score, report.Reason = moves[rand.Intn(len(moves))], 0, "random move, nothing searched"
+	case best.terminal:
+		report.Move, report.Score, report.Reason = best.move, MaxValue, "winning move"
+	default:
+		report.Move, report.Score, report.Reason = best.move, uint8(best.wins/best.visits*MaxValue), "most visited"
+	}
+	finishReport(logger, s.Tracer, report, started)
+	return report.Move, report.Score
+}
+
+// reuseTree moves the root to the subtree matching gb if gb is the previous root position plus
+// up to two moves played in the tree, otherwise it starts a fresh tree.
+func (s *MCTSStrategy) reuseTree(gb *GameBoard, player uint8, moves []Move) {
+	if s.root != nil {
+		if played, ok := boardDiff(&s.rootGb, gb); ok {
+			node := s.root
+			for node != nil && len(played) > 0 {
+				next := node.childPlaying(gb, played)
+				if next == nil {
+					node = nil
+					break
+				}
+				played = removeMove(played, next.move)
+				node = next
+			}
+			if node != nil && gb.rules.PlayerOfMove(node.stones) == player {
+				node.parent = nil
+				s.root = node
+				s.rootGb = gb.Copy()
+				return
+			}
+		}
+	}
+
+	s.root = &mctsNode{
+		player:  1 - player,
+		stones:  gb.Stones(),
+		untried: orderedMoves(gb, moves, player, rand.New(rand.NewSource(rand.Int63()))),
+	}
+	if s.root.stones > 0 {
+		s.root.player = gb.rules.PlayerOfMove(s.root.stones - 1)
+	}
+	s.rootGb = gb.Copy()
+}
+
+// childPlaying returns the child whose move is one of played by the same player, nil if there's none.
+func (n *mctsNode) childPlaying(gb *GameBoard, played []Move) *mctsNode {
+	for _, child := range n.children {
+		for _, move := range played {
+			if child.move == move && playerBoard(gb, child.player).Taken(move.X, move.Y) {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MCTSStrategy) bestChild() *mctsNode {
+	var best *mctsNode
+	for _, child := range s.root.children {
+		if child.terminal {
+			return child
+		}
+		if best == nil || child.visits > best.visits {
+			best = child
+		}
+	}
+	return best
+}
+
+// selectAndExpand walks down the tree by UCT, expands one untried move and returns the new node
+// with the board position after its move. Every node on the path gets a visit right away
+// (a virtual loss) so that parallel workers spread over different branches.
+func (s *MCTSStrategy) selectAndExpand(rng *rand.Rand) (*mctsNode, GameBoard) {
+	board := s.rootGb.Copy()
+	node := s.root
+	node.visits++
+
+	for !node.terminal {
+		if len(node.untried) > 0 {
+			move := node.untried[len(node.untried)-1]
+			node.untried = node.untried[:len(node.untried)-1]
+
+			player := board.rules.PlayerOfMove(node.stones)
+			board.Place(move.X, move.Y, player)
+			child := &mctsNode{
+				move:     move,
+				player:   player,
+				stones:   node.stones + 1,
+				parent:   node,
+				terminal: board.Wins(move.X, move.Y, player),
+			}
+			if !child.terminal {
+				child.untried = orderedMoves(&board, board.PossibleMoves(), board.rules.PlayerOfMove(child.stones), rng)
+			}
+			child.visits++
+			node.children = append(node.children, child)
+			return child, board
+		}
+		if len(node.children) == 0 {
+			break // the board is full
+		}
+
+		node = node.selectChild(s.exploration())
+		board.Place(node.move.X, node.move.Y, node.player)
+		node.visits++
+	}
+	return node, board
+}
+
+func (s *MCTSStrategy) exploration() float64 {
+	if s.Exploration == 0 {
+		return DefaultExploration
+	}
+	return s.Exploration
+}
+
+func (n *mctsNode) selectChild(exploration float64) *mctsNode {
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	logVisits := math.Log(n.visits)
+	for _, child := range n.children {
+		value := child.wins/child.visits + exploration*math.Sqrt(logVisits/child.visits)
+		if value > bestValue {
+			bestValue = value
+			best = child
+		}
+	}
+	return best
+}
+
+// playout plays the game from node until somebody wins or PlayoutDepth moves were made.
+// It returns the score of X: 1 for a win, 0 for a loss, and for an unfinished playout 0.5 or
+// the Evaluator's estimate.
+func (s *MCTSStrategy) playout(board *GameBoard, node *mctsNode, rng *rand.Rand) float64 {
+	if node.terminal {
+		return xScore(node.player, 1)
+	}
+
+	depth := s.PlayoutDepth
+	if depth <= 0 {
+		depth = DefaultPlayoutDepth
+	}
+	stones := node.stones
+	player := board.rules.PlayerOfMove(stones)
+	for i := 0; i < depth; i++ {
+		moves := board.PossibleMoves()
+		if len(moves) == 0 {
+			break
+		}
+		move := s.playoutMove(board, player, moves, rng)
+		board.Place(move.X, move.Y, player)
+		if board.Wins(move.X, move.Y, player) {
+			return xScore(player, 1)
+		}
+		stones++
+		player = board.rules.PlayerOfMove(stones)
+	}
+	if s.Evaluator != nil {
+		return xScore(player, s.Evaluator.Evaluate(board, player))
+	}
+	return 0.5
+}
+
+// xScore converts the score of player to the score of X.
+func xScore(player uint8, score float64) float64 {
+	if player == 0 {
+		return score
+	}
+	return 1 - score
+}
+
+// playoutMove completes our four, blocks the opponent's four, and otherwise with probability
+// PlayoutBias picks a square that makes or defends a smaller threat. The rest is a random move.
+func (s *MCTSStrategy) playoutMove(board *GameBoard, player uint8, moves []Move, rng *rand.Rand) Move {
+	if move, ok := defenseOf(board, board.SearchThreats(board.rules.UrgentPatterns(), player), rng); ok {
+		return move // wins
+	}
+	if move, ok := defenseOf(board, board.SearchThreats(board.rules.UrgentPatterns(), 1-player), rng); ok {
+		return move
+	}
+	if rng.Float64() < s.PlayoutBias {
+		threats := board.SearchThreats(board.rules.Patterns, player)
+		threats = append(threats, board.SearchThreats(board.rules.Patterns, 1-player)...)
+		if move, ok := defenseOf(board, threats, rng); ok {
+			return move
+		}
+	}
+	return moves[rng.Intn(len(moves))]
+}
+
+// defenseOf returns a random playable defense square of one of the threats.
+func defenseOf(board *GameBoard, threats []PatternMatch, rng *rand.Rand) (Move, bool) {
+	var candidates []Move
+	for _, threat := range threats {
+		for _, move := range threat.Defense(board.size) {
+			if move.X < board.size && move.Y < board.size && board.IsEmpty(move.X, move.Y) {
+				candidates = append(candidates, move)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return Move{}, false
+	}
+	return candidates[rng.Intn(len(candidates))], true
+}
+
+func backpropagate(node *mctsNode, xScore float64) {
+	for ; node != nil; node = node.parent {
+		if node.player == 0 {
+			node.wins += xScore
+		} else {
+			node.wins += 1 - xScore
+		}
+	}
+}
+
+func playerBoard(gb *GameBoard, player uint8) *Board {
+	if player == 0 {
+		return &gb.XBoard
+	}
+	return &gb.OBoard
+}
+
+// boardDiff returns the stones present in gb but not in old. It fails if old has a stone that
+// gb doesn't, i.e. gb isn't a continuation of old.
+func boardDiff(old, gb *GameBoard) ([]Move, bool) {
+	if old.size != gb.size {
+		return nil, false
+	}
+	var moves []Move
+	for y := uint8(0); y < gb.size; y++ {
+		oldStones := old.XBoard.vertical[y] | old.OBoard.vertical[y]
+		stones := gb.XBoard.vertical[y] | gb.OBoard.vertical[y]
+		if oldStones&^stones != 0 {
+			return nil, false
+		}
+		for x := uint8(0); x < gb.size; x++ {
+			if (stones&^oldStones)&(1<<x) != 0 {
+				moves = append(moves, Move{x, y})
+			}
+		}
+	}
+	return moves, true
+}
+
+func removeMove(moves []Move, move Move) []Move {
+	for i, m := range moves {
+		if m == move {
+			return append(moves[:i], moves[i+1:]...)
+		}
+	}
+	return moves
+}
+
+// orderedMoves shuffles the moves for expansion, which pops from the end. Squares that complete
+// a four of the player to move or block the opponent's go last, so they are expanded first.
+func orderedMoves(board *GameBoard, moves []Move, player uint8, rng *rand.Rand) []Move {
+	ordered := make([]Move, len(moves))
+	copy(ordered, moves)
+	rng.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+
+	urgent := urgentSquares(board, board.SearchThreats(board.rules.UrgentPatterns(), 1-player))
+	urgent = append(urgent, urgentSquares(board, board.SearchThreats(board.rules.UrgentPatterns(), player))...)
+	end := len(ordered)
+	for _, move := range urgent {
+		for i := 0; i < end; i++ {
+			if ordered[i] == move {
+				end--
+				ordered[i], ordered[end] = ordered[end], ordered[i]
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+func urgentSquares(board *GameBoard, threats []PatternMatch) []Move {
+	var squares []Move
+	for _, threat := range threats {
+		squares = append(squares, threat.Defense(board.size)...)
+	}
+	return squares
+}
@@ -0,0 +1,65 @@
+package pisk_test
+
+import (
+	"martinp/piskvorky/pisk"
+	"testing"
+)
+
+func TestMCTSNextMove(t *testing.T) {
+	type testCase struct {
+		name  string
+		game  []pisk.Move // moves of the game
+		moves []pisk.Move // expected moves (one of)
+	}
+
+	var tests []testCase = []testCase{
+		{
+			name: "complete open four",
+			game: []pisk.Move{
+				{10, 10}, {10, 11}, {11, 10}, {11, 11}, {12, 10}, {12, 12}, {13, 10}, {20, 20},
+			},
+			moves: []pisk.Move{{9, 10}, {14, 10}},
+		},
+		{
+			name: "block four",
+			game: []pisk.Move{
+				{10, 10}, {5, 5}, {11, 11}, {6, 5}, {20, 10}, {7, 5}, {12, 12}, {8, 5}, {13, 13},
+			},
+			moves: []pisk.Move{{4, 5}, {9, 5}},
+		},
+	}
+
+	for _, tc := range tests {
+		strategy := pisk.NewMCTSStrategy()
+		strategy.Iterations = 300
+		strategy.Workers = 2
+
+		game := pisk.NewGame(32, true)
+		numMoves := game.LoadFromArray(tc.game)
+		played, _ := strategy.NextMove(&game.Board, uint8(numMoves%2))
+
+		found := false
+		for _, move := range tc.moves {
+			if move == played {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%v: strategy failed: %v not in %v", tc.name, played, tc.moves)
+		}
+	}
+}
+
+func TestMCTSSelfPlay(t *testing.T) {
+	x := pisk.NewMCTSStrategy()
+	x.Iterations = 200
+	o := pisk.NewMCTSStrategy()
+	o.Iterations = 200
+	o.Workers = 2
+
+	game, _ := pisk.SelfPlay(x, o, 32, 6)
+	if len(game.Log.Moves) != 6 {
+		t.Errorf("expected 6 moves, got %v", len(game.Log.Moves))
+	}
+}
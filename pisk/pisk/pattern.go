@@ -39,6 +39,6 @@ func (p Pattern) MatchWithSpace(xs uint64, os uint64) (bool, uint8) {
 
 var WinningPattern = Pattern{
 	Pat:     uint64(0b11111),
-	NShifts: 26,
+	NShifts: 28, // up to the last column of a 32x32 board
 	Value:   100,
 }
@@ -0,0 +1,169 @@
+package pisk
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var boardPalette = color.Palette{
+	color.RGBA{0xde, 0xb8, 0x87, 0xff}, // board
+	color.RGBA{0x5c, 0x40, 0x33, 0xff}, // grid
+	color.Black,                        // X
+	color.White,                        // O
+	color.RGBA{0xd0, 0x20, 0x20, 0xff}, // last move
+	color.RGBA{0x20, 0x60, 0xd0, 0xff}, // squares of urgent threats
+}
+
+const (
+	colourBoard uint8 = iota
+	colourGrid
+	colourX
+	colourO
+	colourLast
+	colourThreat
+)
+
+// MinCell is the fewest pixels per square that fit a stone.
+const MinCell = 5
+
+// RenderBoard draws gb with cell pixels per square, X as black and O as white stones. It fails if
+// cell is less than MinCell.
+func RenderBoard(gb *GameBoard, cell int) (*image.Paletted, error) {
+	if cell < MinCell {
+		return nil, fmt.Errorf("%d pixels per square, at least %d needed", cell, MinCell)
+	}
+	side := int(gb.size)*cell + 1
+	img := image.NewPaletted(image.Rect(0, 0, side, side), boardPalette)
+	for i := range img.Pix {
+		img.Pix[i] = colourBoard
+	}
+	for i := 0; i < side; i += cell {
+		for j := 0; j < side; j++ {
+			img.SetColorIndex(i, j, colourGrid)
+			img.SetColorIndex(j, i, colourGrid)
+		}
+	}
+
+	radius := cell*2/5 - 1
+	for x := uint8(0); x < gb.size; x++ {
+		for y := uint8(0); y < gb.size; y++ {
+			cx, cy := cellCentre(x, y, cell)
+			switch {
+			case gb.XBoard.Taken(x, y):
+				drawDisc(img, cx, cy, radius, colourX)
+			case gb.OBoard.Taken(x, y):
+				drawDisc(img, cx, cy, radius, colourGrid)
+				drawDisc(img, cx, cy, radius-1, colourO)
+			}
+		}
+	}
+	return img, nil
+}
+
+func cellCentre(x, y uint8, cell int) (int, int) {
+	return int(x)*cell + cell/2, int(y)*cell + cell/2
+}
+
+func drawDisc(img *image.Paletted, cx, cy, radius int, colour uint8) {
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			if dx*dx+dy*dy <= radius*radius {
+				img.SetColorIndex(cx+dx, cy+dy, colour)
+			}
+		}
+	}
+}
+
+// Image renders the current position with the last move marked red and the empty squares of
+// urgent threats, those that must be defended, marked blue.
+func (r *Replay) Image(cell int) (*image.Paletted, error) {
+	gb := r.Board()
+	img, err := RenderBoard(&gb, cell)
+	if err != nil {
+		return nil, err
+	}
+	mark := cell / 8
+	if mark < 1 {
+		mark = 1
+	}
+
+	for _, threats := range r.Threats() {
+		for _, threat := range threats {
+			if threat.Pattern.Value < MustDefend {
+				continue
+			}
+			for _, m := range threat.Defense(r.size) {
+				if m.X < r.size && m.Y < r.size && gb.IsEmpty(m.X, m.Y) {
+					cx, cy := cellCentre(m.X, m.Y, cell)
+					drawDisc(img, cx, cy, mark, colourThreat)
+				}
+			}
+		}
+	}
+	if last, _, ok := r.LastMove(); ok {
+		cx, cy := cellCentre(last.X, last.Y, cell)
+		drawDisc(img, cx, cy, mark, colourLast)
+	}
+	return img, nil
+}
+
+// WriteGIF writes the game as an animated GIF, one frame per ply from the empty board to the
+// final position, which is shown longer. The current ply is kept.
+func (r *Replay) WriteGIF(w io.Writer, cell int, delay time.Duration) error {
+	ply := r.ply
+	defer r.Seek(ply)
+
+	anim := &gif.GIF{}
+	for i := 0; i <= r.Len(); i++ {
+		r.Seek(i)
+		img, err := r.Image(cell)
+		if err != nil {
+			return err
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond)))
+	}
+	anim.Delay[len(anim.Delay)-1] *= 4
+	return gif.EncodeAll(w, anim)
+}
+
+// SavePNGs saves a PNG image of every ply to dir as ply-000.png, ply-001.png ... and returns
+// the file names. The current ply is kept.
+func (r *Replay) SavePNGs(dir string, cell int) ([]string, error) {
+	ply := r.ply
+	defer r.Seek(ply)
+
+	var files []string
+	for i := 0; i <= r.Len(); i++ {
+		r.Seek(i)
+		img, err := r.Image(cell)
+		if err != nil {
+			return files, err
+		}
+		filename := filepath.Join(dir, fmt.Sprintf("ply-%03d.png", i))
+		if err := savePNG(filename, img); err != nil {
+			return files, err
+		}
+		files = append(files, filename)
+	}
+	return files, nil
+}
+
+func savePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,81 @@
+package pisk
+
+// Replay steps through a saved game. The position after Ply moves is rebuilt from the log, ply 0
+// is the empty board.
+type Replay struct {
+	Log   *GameLog
+	size  uint8
+	rules Rules
+	ply   int
+}
+
+// NewReplay creates a Replay of gl on its board, of boardSize if gl doesn't record the size.
+func NewReplay(gl *GameLog, boardSize uint8) (*Replay, error) {
+	rules, err := RulesByName(gl.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if gl.BoardSize != 0 {
+		boardSize = gl.BoardSize
+	}
+	return &Replay{Log: gl, size: boardSize, rules: rules}, nil
+}
+
+// Len returns the number of moves of the game.
+func (r *Replay) Len() int {
+	return len(r.Log.Moves)
+}
+
+func (r *Replay) Ply() int {
+	return r.ply
+}
+
+// Forward moves one move forward, it returns false at the end of the game.
+func (r *Replay) Forward() bool {
+	return r.Seek(r.ply + 1)
+}
+
+// Back moves one move back, it returns false at the start of the game.
+func (r *Replay) Back() bool {
+	return r.Seek(r.ply - 1)
+}
+
+// Seek jumps to the position after ply moves. It returns false for a ply outside of the game.
+func (r *Replay) Seek(ply int) bool {
+	if ply < 0 || ply > r.Len() {
+		return false
+	}
+	r.ply = ply
+	return true
+}
+
+// Board returns the position at the current ply.
+func (r *Replay) Board() GameBoard {
+	gb := NewGameBoardWithRules(r.size, r.rules)
+	for i, move := range r.Log.Moves[:r.ply] {
+		gb.Place(move.X, move.Y, r.rules.PlayerOfMove(i))
+	}
+	return gb
+}
+
+// LastMove returns the move that led to the current position and the player who made it.
+func (r *Replay) LastMove() (Move, uint8, bool) {
+	if r.ply == 0 {
+		return Move{}, 0, false
+	}
+	return r.Log.Moves[r.ply-1], r.rules.PlayerOfMove(r.ply - 1), true
+}
+
+// NextPlayer returns the player to move in the current position.
+func (r *Replay) NextPlayer() uint8 {
+	return r.rules.PlayerOfMove(r.ply)
+}
+
+// Threats returns the threats of both players in the current position.
+func (r *Replay) Threats() [2][]PatternMatch {
+	gb := r.Board()
+	return [2][]PatternMatch{
+		gb.SearchThreats(r.rules.Patterns, 0),
+		gb.SearchThreats(r.rules.Patterns, 1),
+	}
+}
@@ -0,0 +1,116 @@
+package pisk_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"martinp/piskvorky/pisk"
+	"os"
+	"testing"
+	"time"
+)
+
+func replayOf(t *testing.T, moves []pisk.Move) *pisk.Replay {
+	game := pisk.NewGame(16, true)
+	game.LoadFromArray(moves)
+	r, err := pisk.NewReplay(game.Log, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReplaySteps(t *testing.T) {
+	r := replayOf(t, []pisk.Move{{3, 3}, {3, 4}, {4, 3}, {4, 4}, {5, 3}, {5, 4}, {6, 3}})
+	if r.Back() {
+		t.Error("stepped back from the start")
+	}
+	for i := 1; i <= r.Len(); i++ {
+		if !r.Forward() {
+			t.Fatalf("can't step to move %d", i)
+		}
+		gb := r.Board()
+		if gb.Stones() != i {
+			t.Errorf("move %d: %d stones", i, gb.Stones())
+		}
+	}
+	if r.Forward() {
+		t.Error("stepped past the end")
+	}
+
+	threats := r.Threats()
+	if len(threats[0]) == 0 {
+		t.Error("no threats of X's open four")
+	}
+
+	if !r.Seek(2) || r.Ply() != 2 || r.NextPlayer() != 0 {
+		t.Errorf("after seek: ply %d, next %d", r.Ply(), r.NextPlayer())
+	}
+	if move, player, ok := r.LastMove(); !ok || move != (pisk.Move{X: 3, Y: 4}) || player != 1 {
+		t.Errorf("unexpected last move %v by %d", move, player)
+	}
+	if r.Seek(8) || r.Seek(-1) || r.Ply() != 2 {
+		t.Errorf("seek outside of the game changed the ply to %d", r.Ply())
+	}
+	if !r.Back() || r.Ply() != 1 {
+		t.Errorf("unexpected ply after back %d", r.Ply())
+	}
+}
+
+func TestReplayImages(t *testing.T) {
+	r := replayOf(t, []pisk.Move{{3, 3}, {3, 4}, {4, 3}})
+	r.Seek(1)
+
+	var buf bytes.Buffer
+	if err := r.WriteGIF(&buf, 10, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != r.Len()+1 || anim.Delay[0] != 20 {
+		t.Errorf("%d frames with delay %d", len(anim.Image), anim.Delay[0])
+	}
+	if r.Ply() != 1 {
+		t.Errorf("export moved the replay to ply %d", r.Ply())
+	}
+
+	files, err := r.SavePNGs(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != r.Len()+1 {
+		t.Fatalf("%d images", len(files))
+	}
+	f, err := os.Open(files[len(files)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the edge of X's first stone at 3 3 and O's stone at 3 4, the centres mark the last move
+	if c := color.GrayModel.Convert(img.At(3*10+2, 3*10+5)).(color.Gray); c.Y != 0 {
+		t.Errorf("X stone isn't black: %v", c)
+	}
+	if c := color.GrayModel.Convert(img.At(3*10+3, 4*10+5)).(color.Gray); c.Y != 0xff {
+		t.Errorf("O stone isn't white: %v", c)
+	}
+}
+
+func TestReplayImageCell(t *testing.T) {
+	r := replayOf(t, []pisk.Move{{3, 3}})
+	for _, cell := range []int{-1, 0, pisk.MinCell - 1} {
+		if err := r.WriteGIF(io.Discard, cell, time.Second); err == nil {
+			t.Errorf("%d pixels per square accepted", cell)
+		}
+	}
+	if _, err := r.Image(pisk.MinCell); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package pisk
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Outcome uint8
+
+const (
+	Unfinished Outcome = iota
+	XWins
+	OWins
+	Draw
+)
+
+const (
+	ReasonFive        = "five"
+	ReasonRow         = "row" // the winning row of a game other than gomoku
+	ReasonTime        = "time"
+	ReasonResignation = "resignation"
+	ReasonFullBoard   = "full-board"
+	ReasonMoveLimit   = "move-limit"
+)
+
+var outcomeNames = []string{"unfinished", "x-wins", "o-wins", "draw"}
+
+func (o Outcome) String() string {
+	if int(o) < len(outcomeNames) {
+		return outcomeNames[o]
+	}
+	return "invalid"
+}
+
+// Result of a game: the outcome and why the game ended, one of the Reason constants.
+type Result struct {
+	Outcome Outcome
+	Reason  string
+}
+
+// WinResult returns the result of player winning for reason.
+func WinResult(player uint8, reason string) Result {
+	if player == 0 {
+		return Result{XWins, reason}
+	}
+	return Result{OWins, reason}
+}
+
+func (r Result) Finished() bool {
+	return r.Outcome != Unfinished
+}
+
+// Winner returns the winning player, -1 for an unfinished or drawn game.
+func (r Result) Winner() int {
+	switch r.Outcome {
+	case XWins:
+		return 0
+	case OWins:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// String returns the outcome followed by the reason, e.g. "x-wins five".
+func (r Result) String() string {
+	if r.Reason == "" {
+		return r.Outcome.String()
+	}
+	return r.Outcome.String() + " " + r.Reason
+}
+
+// ParseResult parses the format of Result.String.
+func ParseResult(s string) (Result, error) {
+	parts := strings.SplitN(s, " ", 2)
+	for i, name := range outcomeNames {
+		if parts[0] == name {
+			r := Result{Outcome: Outcome(i)}
+			if len(parts) == 2 {
+				r.Reason = parts[1]
+			}
+			return r, nil
+		}
+	}
+	return Result{}, fmt.Errorf("invalid result: %q", s)
+}
@@ -0,0 +1,156 @@
+package pisk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rules of a k-in-a-row game: how many stones in a row win, how many stones a player places per
+// turn, and the threat patterns the strategies look for.
+type Rules struct {
+	Name            string
+	WinLength       uint8
+	FirstTurnStones uint8 // stones X places in the very first turn
+	StonesPerTurn   uint8 // stones placed in every other turn
+	Patterns        []Pattern
+}
+
+var (
+	Gomoku    = Rules{Name: "gomoku", WinLength: 5, FirstTurnStones: 1, StonesPerTurn: 1, Patterns: ThreatPatterns}
+	TicTacToe = Rules{Name: "tic-tac-toe", WinLength: 3, FirstTurnStones: 1, StonesPerTurn: 1, Patterns: KInARowPatterns(3)}
+	Connect6  = Rules{Name: "connect6", WinLength: 6, FirstTurnStones: 1, StonesPerTurn: 2, Patterns: KInARowPatterns(6)}
+)
+
+// KInARow returns the rules of k in a row with one stone per turn.
+func KInARow(k uint8) Rules {
+	if k == Gomoku.WinLength {
+		return Gomoku
+	}
+	return Rules{
+		Name:            fmt.Sprintf("k-in-a-row:%d", k),
+		WinLength:       k,
+		FirstTurnStones: 1,
+		StonesPerTurn:   1,
+		Patterns:        KInARowPatterns(k),
+	}
+}
+
+// RulesByName returns the rules named by Rules.Name.
+func RulesByName(name string) (Rules, error) {
+	switch name {
+	case "", Gomoku.Name:
+		return Gomoku, nil
+	case TicTacToe.Name:
+		return TicTacToe, nil
+	case Connect6.Name:
+		return Connect6, nil
+	}
+	if strings.HasPrefix(name, "k-in-a-row:") {
+		k, err := strconv.ParseUint(strings.TrimPrefix(name, "k-in-a-row:"), 10, 8)
+		if err == nil && k >= 2 && k <= 16 {
+			return KInARow(uint8(k)), nil
+		}
+	}
+	return Rules{}, fmt.Errorf("unknown rules: %q", name)
+}
+
+// PlayerOfMove returns the player who places the stone number i (from 0) of a game.
+func (r Rules) PlayerOfMove(i int) uint8 {
+	if i < int(r.FirstTurnStones) {
+		return 0
+	}
+	turn := (i-int(r.FirstTurnStones))/int(r.StonesPerTurn) + 1
+	return uint8(turn % 2)
+}
+
+// OneStonePerTurn reports whether the players take turns after every stone. Coach, ForcedLoss
+// and Depth1Strategy look one stone ahead and only understand such rules.
+func (r Rules) OneStonePerTurn() bool {
+	return r.FirstTurnStones == 1 && r.StonesPerTurn == 1
+}
+
+// WinningPattern returns the pattern of WinLength stones in a row.
+func (r Rules) WinningPattern() Pattern {
+	return Pattern{
+		Pat:     1<<r.WinLength - 1,
+		NShifts: 64 - r.WinLength + 1,
+		Value:   MaxValue,
+	}
+}
+
+// UrgentPatterns returns the Patterns that win on the next move unless defended.
+func (r Rules) UrgentPatterns() []Pattern {
+	var patterns []Pattern
+	for _, p := range r.Patterns {
+		if p.Value >= MustDefend && p.Value != MaxValue {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// KInARowPatterns generates threat patterns for k in a row in the manner of ThreatPatterns:
+// k-1 stones open on both ends (128), k-1 stones with one empty square to complete them (101),
+// k-2 stones open on both ends (2) and k stones (MaxValue). Patterns are limited to a 32 wide
+// board like ThreatPatterns.
+func KInARowPatterns(k uint8) []Pattern {
+	var patterns []Pattern
+	full := uint64(1)<<k - 1
+	shifts := func(width uint8) uint8 { return 32 - width + 1 }
+
+	if k >= 4 {
+		patterns = append(patterns, Pattern{ // open k-2
+			Pat:     (full >> 2) << 1,
+			Space:   1 | 1<<(k-1),
+			NShifts: shifts(k),
+			Value:   2,
+			Defense: []uint8{0, k - 1},
+		})
+	}
+	if k >= 3 {
+		patterns = append(patterns, Pattern{ // open k-1
+			Pat:     (full >> 1) << 1,
+			Space:   1 | 1<<k,
+			NShifts: shifts(k + 1),
+			Value:   128,
+			Defense: []uint8{0, k},
+		})
+	}
+	for gap := uint8(0); gap < k; gap++ { // k-1 and one empty square, at the ends or inside
+		patterns = append(patterns, Pattern{
+			Pat:     full &^ (1 << gap),
+			Space:   1 << gap,
+			NShifts: shifts(k),
+			Value:   101,
+			Defense: []uint8{gap},
+		})
+	}
+	patterns = append(patterns, Pattern{
+		Pat:     full,
+		NShifts: shifts(k),
+		Value:   MaxValue,
+		Defense: []uint8{},
+	})
+	return patterns
+}
+
+// inRow reports whether the stone at x, y is part of k or more stones in a row.
+func inRow(b *Board, x, y uint8, k uint8) bool {
+	for _, d := range [4][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+		if 1+countDirection(b, x, y, d[0], d[1])+countDirection(b, x, y, -d[0], -d[1]) >= int(k) {
+			return true
+		}
+	}
+	return false
+}
+
+func countDirection(b *Board, x, y uint8, dx, dy int) int {
+	n := 0
+	cx, cy := int(x)+dx, int(y)+dy
+	for cx >= 0 && cy >= 0 && cx < int(b.size) && cy < int(b.size) && b.Taken(uint8(cx), uint8(cy)) {
+		n++
+		cx, cy = cx+dx, cy+dy
+	}
+	return n
+}
@@ -0,0 +1,203 @@
+package pisk_test
+
+import (
+	"martinp/piskvorky/pisk"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTicTacToe(t *testing.T) {
+	game := pisk.NewGameWithRules(3, pisk.TicTacToe)
+	game.LoadFromArray([]pisk.Move{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}})
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.XWins, Reason: pisk.ReasonRow}) {
+		t.Errorf("unexpected result %v", r)
+	}
+
+	game = pisk.NewGameWithRules(3, pisk.TicTacToe)
+	// X O X
+	// X O O
+	// O X X
+	game.LoadFromArray([]pisk.Move{{0, 0}, {1, 0}, {2, 0}, {1, 1}, {0, 1}, {2, 1}, {1, 2}, {0, 2}, {2, 2}})
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.Draw, Reason: pisk.ReasonFullBoard}) {
+		t.Errorf("unexpected result of a drawn game %v", r)
+	}
+}
+
+func TestConnect6Turns(t *testing.T) {
+	game := pisk.NewGameWithRules(19, pisk.Connect6)
+	expected := []uint8{0, 1, 1, 0, 0, 1, 1, 0}
+	for i, player := range expected {
+		if next := game.NextPlayer(); next != player {
+			t.Fatalf("stone %d: expected player %d, got %d", i, player, next)
+		}
+		if game.Play(pisk.Move{X: uint8(i), Y: 10}, 1-player) {
+			t.Fatalf("stone %d: accepted out of turn", i)
+		}
+		if !game.Play(pisk.Move{X: uint8(i), Y: 10 + player}, player) {
+			t.Fatalf("stone %d: move rejected", i)
+		}
+	}
+
+	game = pisk.NewGameWithRules(19, pisk.Connect6)
+	// X plays a row of six two stones per turn, O plays far away
+	game.LoadFromArray([]pisk.Move{{0, 0}, {0, 18}, {1, 18}, {1, 0}, {2, 0}, {2, 18}, {3, 18}, {3, 0}, {4, 0}, {4, 18}, {5, 17}})
+	if game.Result().Finished() {
+		t.Fatalf("game finished early: %v", game.Result())
+	}
+	game.Play(pisk.Move{X: 5, Y: 0}, 0)
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.XWins, Reason: pisk.ReasonRow}) {
+		t.Errorf("unexpected result %v", r)
+	}
+}
+
+func TestKInARow(t *testing.T) {
+	if pisk.KInARow(5).Name != pisk.Gomoku.Name {
+		t.Error("five in a row isn't gomoku")
+	}
+
+	rules := pisk.KInARow(4)
+	gb := pisk.NewGameBoardWithRules(8, rules)
+	for x := uint8(2); x < 5; x++ {
+		gb.Place(x, 3, 0)
+	}
+	if len(gb.SearchThreats(rules.UrgentPatterns(), 0)) == 0 {
+		t.Error("open three isn't urgent in four in a row")
+	}
+	gb.Place(5, 3, 0)
+	if !gb.XWon() || !gb.Wins(5, 3, 0) {
+		t.Error("four in a row doesn't win")
+	}
+
+	for _, rules := range []pisk.Rules{pisk.Gomoku, pisk.TicTacToe, pisk.Connect6, rules} {
+		found, err := pisk.RulesByName(rules.Name)
+		if err != nil || found.Name != rules.Name || found.WinLength != rules.WinLength {
+			t.Errorf("RulesByName(%q) = %v, %v", rules.Name, found.Name, err)
+		}
+	}
+	if _, err := pisk.RulesByName("chess"); err == nil {
+		t.Error("unknown rules accepted")
+	}
+}
+
+func TestSmallBoardThreats(t *testing.T) {
+	// two stones on the edge of a row and of a diagonal can't be open on both ends
+	for _, stones := range [][2]pisk.Move{{{1, 0}, {2, 0}}, {{2, 0}, {1, 1}}} {
+		gb := pisk.NewGameBoardWithRules(3, pisk.TicTacToe)
+		for _, s := range stones {
+			gb.Place(s.X, s.Y, 0)
+		}
+		threats := gb.SearchThreats(pisk.TicTacToe.Patterns, 0)
+		if len(threats) == 0 {
+			t.Errorf("%v: no threat", stones)
+		}
+		for _, pm := range threats {
+			if pm.Value == 128 {
+				t.Errorf("%v: open two %+v", stones, pm)
+			}
+			for _, d := range pm.Defense(3) {
+				if d.X >= 3 || d.Y >= 3 || !gb.IsEmpty(d.X, d.Y) {
+					t.Errorf("%v: defense %v of %+v", stones, d, pm)
+				}
+			}
+		}
+	}
+}
+
+func TestRulesLog(t *testing.T) {
+	game := pisk.NewGameWithRules(19, pisk.Connect6)
+	game.LoadFromArray([]pisk.Move{{9, 9}, {10, 10}, {10, 11}, {8, 8}})
+	filename := filepath.Join(t.TempDir(), "connect6.log")
+	game.Log.SaveToFile(filename)
+
+	loaded := pisk.NewGame(32, true)
+	loaded.LoadFromFile(filename)
+	if loaded.Board.Rules().Name != pisk.Connect6.Name || loaded.Board.Size() != 19 {
+		t.Fatalf("loaded rules %q on %d squares", loaded.Board.Rules().Name, loaded.Board.Size())
+	}
+	r, _ := pisk.NewReplay(loaded.Log, 32)
+	if b := r.Board(); b.Size() != 19 {
+		t.Errorf("replayed on %d squares", b.Size())
+	}
+	if loaded.NextPlayer() != 0 || loaded.Log.NextPlayer() != 0 || loaded.Board.Stones() != 4 {
+		t.Errorf("unexpected position after loading: next %d, %d stones", loaded.NextPlayer(), loaded.Board.Stones())
+	}
+}
+
+func TestRulesClock(t *testing.T) {
+	// X places 1 stone, then O 2 and X 1 of its 2
+	filename := filepath.Join(t.TempDir(), "connect6.log")
+	data := "# rules: connect6\n# time-control: 1m0s+10s\n9 9 1s\n10 10 2s\n10 11 3s\n8 8 4s\n"
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := pisk.NewGame(19, true)
+	loaded.LoadFromFile(filename)
+	// the increment once per finished turn
+	if remaining := loaded.Clock.Remaining; remaining != [2]time.Duration{65 * time.Second, 65 * time.Second} {
+		t.Errorf("remaining %v", remaining)
+	}
+	if loaded.Log.NextPlayer() != 0 {
+		t.Errorf("O to move after %d stones", len(loaded.Log.Moves))
+	}
+}
+
+func TestConnect6Clock(t *testing.T) {
+	now, advance := fakeTime()
+	tc := pisk.TimeControl{Initial: 10 * time.Second, Increment: 2 * time.Second, PerMove: 5 * time.Second}
+	game := pisk.NewGameWithRules(19, pisk.Connect6)
+	game.Log.TimeControl = tc
+	game.Clock = pisk.NewClock(tc)
+	game.Clock.Now = now
+
+	game.Play(pisk.Move{X: 9, Y: 9}, 0)
+	advance(2 * time.Second)
+	game.Play(pisk.Move{X: 10, Y: 10}, 1)
+	if game.Clock.Remaining != [2]time.Duration{12 * time.Second, 10 * time.Second} {
+		t.Errorf("O charged before the end of the turn: %v", game.Clock.Remaining)
+	}
+	advance(2 * time.Second)
+	game.Play(pisk.Move{X: 10, Y: 11}, 1)
+	if game.Clock.Remaining != [2]time.Duration{12 * time.Second, 8 * time.Second} {
+		t.Errorf("unexpected remaining time %v", game.Clock.Remaining)
+	}
+	if times := game.Log.Times; len(times) != 3 || times[1] != 2*time.Second || times[2] != 2*time.Second {
+		t.Errorf("unexpected times of the stones %v", times)
+	}
+
+	// the per move limit is for the whole turn
+	advance(3 * time.Second)
+	if !game.Play(pisk.Move{X: 8, Y: 8}, 0) {
+		t.Fatal("the first stone of the turn rejected")
+	}
+	advance(3 * time.Second)
+	if game.Play(pisk.Move{X: 7, Y: 7}, 0) {
+		t.Error("turn over the per move limit accepted")
+	}
+	if r := game.Result(); r != (pisk.Result{Outcome: pisk.OWins, Reason: pisk.ReasonTime}) {
+		t.Errorf("unexpected result %v", r)
+	}
+
+	filename := filepath.Join(t.TempDir(), "connect6.log")
+	game.Log.SaveToFile(filename)
+	loaded := pisk.NewGame(19, true)
+	loaded.LoadFromFile(filename)
+	if remaining := loaded.Clock.Remaining; remaining != [2]time.Duration{9 * time.Second, 8 * time.Second} {
+		t.Errorf("loaded remaining %v", remaining)
+	}
+}
+
+func TestMCTSTicTacToe(t *testing.T) {
+	gb := pisk.NewGameBoardWithRules(3, pisk.TicTacToe)
+	gb.Place(0, 0, 0)
+	gb.Place(1, 1, 1)
+	gb.Place(0, 1, 0)
+	gb.Place(2, 2, 1)
+	s := pisk.NewMCTSStrategy()
+	s.Iterations = 500
+	move, _ := s.NextMove(&gb, 0)
+	if move != (pisk.Move{X: 0, Y: 2}) {
+		t.Errorf("expected the winning move 0 2, got %v", move)
+	}
+}
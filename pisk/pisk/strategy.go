@@ -0,0 +1,23 @@
+package pisk
+
+// Strategy picks the next move for player and returns it with its score (0..MaxValue).
+type Strategy interface {
+	NextMove(gb *GameBoard, player uint8) (Move, uint8)
+}
+
+// SelfPlay plays a game of x against o on a new board, X moving first. The game ends when somebody
+// wins, a strategy returns an invalid move (and loses), or after maxMoves moves (a draw).
+// It returns the played game and the winner, -1 for a draw.
+func SelfPlay(x, o Strategy, boardSize uint8, maxMoves int) (*Game, int) {
+	game := NewGame(boardSize, true)
+	strategies := [2]Strategy{x, o}
+
+	for i := 0; i < maxMoves && !game.Result().Finished(); i++ {
+		player := game.NextPlayer()
+		move, _ := strategies[player].NextMove(&game.Board, player)
+		if !game.Play(move, player) {
+			game.Resign(player)
+		}
+	}
+	return game, game.Result().Winner()
+}
@@ -0,0 +1,101 @@
+package pisk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// discardHandler drops all records so that an engine without a configured logger stays silent.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var silentLogger = slog.New(discardHandler{})
+
+// CandidateScore is one move considered by a strategy. Visits is only set by MCTSStrategy.
+type CandidateScore struct {
+	Move   Move    `json:"move"`
+	Score  float64 `json:"score"`
+	Visits int     `json:"visits,omitempty"`
+}
+
+// SearchReport describes how a strategy picked its move.
+type SearchReport struct {
+	Strategy   string           `json:"strategy"`
+	Player     uint8            `json:"player"`
+	Candidates []CandidateScore `json:"candidates"`
+	Threats    int              `json:"threats"` // opponent's threats on the board
+	Move       Move             `json:"move"`
+	Score      uint8            `json:"score"`
+	Reason     string           `json:"reason"`
+	Duration   time.Duration    `json:"durationNs"`
+}
+
+// Tracer receives a SearchReport for every move a strategy makes.
+type Tracer interface {
+	TraceSearch(report *SearchReport)
+}
+
+// JSONTracer writes search reports as JSON lines, one report per line.
+type JSONTracer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{encoder: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) TraceSearch(report *SearchReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.encoder.Encode(report) // tracing must not break the game
+}
+
+// LogValue implements slog.LogValuer.
+func (pm PatternMatch) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("pattern", strconv.FormatUint(pm.Pattern.Pat, 2)),
+		slog.Int("value", int(pm.Pattern.Value)),
+		slog.String("direction", directionName(pm.Direction)),
+		slog.Int("index", int(pm.Index)),
+		slog.Int("shift", int(pm.Shift)),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (m Move) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("x", int(m.X)), slog.Int("y", int(m.Y)))
+}
+
+func loggerOrSilent(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return silentLogger
+	}
+	return logger
+}
+
+// finishReport logs the chosen move and hands the report to the tracer.
+func finishReport(logger *slog.Logger, tracer Tracer, report *SearchReport, started time.Time) {
+	report.Duration = time.Since(started)
+	logger.Info("move chosen",
+		"strategy", report.Strategy,
+		"player", report.Player,
+		"move", report.Move,
+		"score", report.Score,
+		"reason", report.Reason,
+		"candidates", len(report.Candidates),
+		"duration", report.Duration,
+	)
+	if tracer != nil {
+		tracer.TraceSearch(report)
+	}
+}
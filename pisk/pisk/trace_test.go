@@ -0,0 +1,28 @@
+package pisk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"martinp/piskvorky/pisk"
+	"testing"
+)
+
+func TestJSONTracer(t *testing.T) {
+	var buf bytes.Buffer
+	strategy := pisk.Depth1Strategy{Tracer: pisk.NewJSONTracer(&buf)}
+
+	game := pisk.NewGame(32, true)
+	game.LoadFromArray([]pisk.Move{{10, 10}, {10, 11}, {11, 10}, {11, 11}, {12, 10}, {12, 12}, {13, 10}, {20, 20}})
+	move, score := strategy.NextMove(&game.Board, 0)
+
+	var report pisk.SearchReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid trace %q: %v", buf.String(), err)
+	}
+	if report.Strategy != "depth1" || report.Move != move || report.Score != score {
+		t.Errorf("report %+v doesn't match move %v, score %v", report, move, score)
+	}
+	if report.Reason != "winning move" || len(report.Candidates) == 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
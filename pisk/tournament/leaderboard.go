@@ -0,0 +1,109 @@
+package tournament
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	InitialRating = 1500
+	EloK          = 32
+)
+
+// ExpectedScore returns the expected score of a player rated a against a player rated b.
+func ExpectedScore(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// UpdateElo returns the new ratings after a game in which the player rated a scored score
+// (1 win, 0.5 draw, 0 loss) against the player rated b.
+func UpdateElo(a, b, score float64) (float64, float64) {
+	delta := EloK * (score - ExpectedScore(a, b))
+	return a + delta, b - delta
+}
+
+// Standing is a player's entry in the leaderboard.
+type Standing struct {
+	UserId   string  `json:"userId"`
+	Nickname string  `json:"nickname"`
+	Rating   float64 `json:"rating"`
+	Points   float64 `json:"points"` // tournament points, 1 per win or bye, 0.5 per draw
+	Wins     int     `json:"wins"`
+	Draws    int     `json:"draws"`
+	Losses   int     `json:"losses"`
+	Byes     int     `json:"byes"`
+	XGames   int     `json:"xGames"` // games played as X, used to balance colours
+}
+
+// Leaderboard keeps the standings of all registered players. Ratings carry over between
+// tournaments, points are reset when a tournament starts.
+type Leaderboard struct {
+	Standings map[string]*Standing `json:"standings"`
+}
+
+func NewLeaderboard() *Leaderboard {
+	return &Leaderboard{Standings: map[string]*Standing{}}
+}
+
+func (l *Leaderboard) Add(userId, nickname string) *Standing {
+	s := &Standing{UserId: userId, Nickname: nickname, Rating: InitialRating}
+	l.Standings[userId] = s
+	return s
+}
+
+// ResetPoints starts a new tournament for the players, keeping their ratings.
+func (l *Leaderboard) ResetPoints() {
+	for _, s := range l.Standings {
+		s.Points = 0
+	}
+}
+
+// RecordGame updates the standings of x and o after a game, winner is 0 for x, 1 for o and
+// -1 for a draw.
+func (l *Leaderboard) RecordGame(x, o string, winner int) {
+	sx, so := l.Standings[x], l.Standings[o]
+	sx.XGames++
+
+	var score float64
+	switch winner {
+	case 0:
+		score = 1
+		sx.Wins++
+		so.Losses++
+	case 1:
+		so.Wins++
+		sx.Losses++
+	default:
+		score = 0.5
+		sx.Draws++
+		so.Draws++
+	}
+	sx.Points += score
+	so.Points += 1 - score
+	sx.Rating, so.Rating = UpdateElo(sx.Rating, so.Rating, score)
+}
+
+// RecordBye gives a point to a player left without an opponent in a round.
+func (l *Leaderboard) RecordBye(userId string) {
+	s := l.Standings[userId]
+	s.Byes++
+	s.Points++
+}
+
+// Sorted returns the standings ordered by points, then rating.
+func (l *Leaderboard) Sorted() []*Standing {
+	standings := make([]*Standing, 0, len(l.Standings))
+	for _, s := range l.Standings {
+		standings = append(standings, s)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Points != standings[j].Points {
+			return standings[i].Points > standings[j].Points
+		}
+		if standings[i].Rating != standings[j].Rating {
+			return standings[i].Rating > standings[j].Rating
+		}
+		return standings[i].UserId < standings[j].UserId
+	})
+	return standings
+}
@@ -0,0 +1,127 @@
+package tournament
+
+// Pair is a game of a round, the first player plays X. An empty O means a bye for X.
+type Pair [2]string
+
+// RoundRobin returns all rounds of a round robin tournament by the circle method: the first
+// player stays in place and the others rotate. Colours alternate between rounds.
+func RoundRobin(players []string) [][]Pair {
+	circle := append([]string{}, players...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "") // the bye
+	}
+	n := len(circle)
+
+	var rounds [][]Pair
+	for r := 0; r < n-1; r++ {
+		var round []Pair
+		for i := 0; i < n/2; i++ {
+			a, b := circle[i], circle[n-1-i]
+			if (r+i)%2 == 1 {
+				a, b = b, a
+			}
+			round = append(round, orderBye(a, b))
+		}
+		rounds = append(rounds, round)
+		// rotate everybody but the first player by one place
+		last := circle[n-1]
+		copy(circle[2:], circle[1:n-1])
+		circle[1] = last
+	}
+	return rounds
+}
+
+// swissSteps bounds the search for pairings without rematches, it takes exponential time when
+// there are none or only few of them.
+const swissSteps = 100000
+
+// Swiss pairs the standings, which are sorted from the best, for the next round of a Swiss
+// tournament. Each player is paired with the best ranked player they haven't played yet, going
+// back over earlier choices when the rest can't be paired without a rematch. If that doesn't find
+// pairings without rematches within swissSteps, each player is paired with the best ranked player
+// they haven't played yet as long as there is one, and with the best ranked one otherwise. With an
+// odd number of players the lowest ranked player without a bye yet gets one. The player with fewer
+// games as X plays X.
+func Swiss(standings []*Standing, played map[Pair]bool) []Pair {
+	var pairs []Pair
+	remaining := append([]*Standing{}, standings...)
+
+	if len(remaining)%2 == 1 {
+		bye := len(remaining) - 1
+		for i := len(remaining) - 1; i >= 0; i-- {
+			if remaining[i].Byes == 0 {
+				bye = i
+				break
+			}
+		}
+		pairs = append(pairs, Pair{remaining[bye].UserId, ""})
+		remaining = append(remaining[:bye], remaining[bye+1:]...)
+	}
+
+	met := func(a, b *Standing) bool {
+		return played[Pair{a.UserId, b.UserId}] || played[Pair{b.UserId, a.UserId}]
+	}
+	steps := swissSteps
+	matched, ok := pairSwiss(remaining, met, &steps)
+	if !ok {
+		matched = pairGreedy(remaining, met)
+	}
+	for _, pair := range matched {
+		a, b := pair[0], pair[1]
+		if a.XGames > b.XGames {
+			a, b = b, a
+		}
+		pairs = append(pairs, Pair{a.UserId, b.UserId})
+	}
+	return pairs
+}
+
+// pairSwiss pairs the first player with the best ranked one they haven't met such that the rest
+// can be paired too. It gives up once it tried steps pairs.
+func pairSwiss(remaining []*Standing, met func(a, b *Standing) bool, steps *int) ([][2]*Standing, bool) {
+	if len(remaining) == 0 {
+		return nil, true
+	}
+	a := remaining[0]
+	for i := 1; i < len(remaining); i++ {
+		if met(a, remaining[i]) {
+			continue
+		}
+		if *steps--; *steps < 0 {
+			return nil, false
+		}
+		rest := make([]*Standing, 0, len(remaining)-2)
+		rest = append(rest, remaining[1:i]...)
+		rest = append(rest, remaining[i+1:]...)
+		if pairs, ok := pairSwiss(rest, met, steps); ok {
+			return append([][2]*Standing{{a, remaining[i]}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// pairGreedy pairs the first player with the best ranked one they haven't met, or with the next
+// one if they met everybody, and so on without going back.
+func pairGreedy(remaining []*Standing, met func(a, b *Standing) bool) [][2]*Standing {
+	remaining = append([]*Standing{}, remaining...)
+	var pairs [][2]*Standing
+	for len(remaining) > 1 {
+		a, b := remaining[0], 1
+		for i := 1; i < len(remaining); i++ {
+			if !met(a, remaining[i]) {
+				b = i
+				break
+			}
+		}
+		pairs = append(pairs, [2]*Standing{a, remaining[b]})
+		remaining = append(remaining[1:b], remaining[b+1:]...)
+	}
+	return pairs
+}
+
+func orderBye(a, b string) Pair {
+	if a == "" {
+		return Pair{b, ""}
+	}
+	return Pair{a, b}
+}
@@ -0,0 +1,114 @@
+package tournament
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoundRobin(t *testing.T) {
+	for n := 2; n <= 7; n++ {
+		var players []string
+		for i := 0; i < n; i++ {
+			players = append(players, fmt.Sprint(i))
+		}
+		rounds := RoundRobin(players)
+
+		met := map[[2]string]int{}
+		for _, round := range rounds {
+			inRound := map[string]bool{}
+			for _, pair := range round {
+				for _, p := range pair {
+					if p != "" && inRound[p] {
+						t.Fatalf("%v players: %v plays twice in a round: %v", n, p, round)
+					}
+					inRound[p] = true
+				}
+				if pair[1] != "" {
+					a, b := pair[0], pair[1]
+					if a > b {
+						a, b = b, a
+					}
+					met[[2]string{a, b}]++
+				}
+			}
+		}
+		if len(met) != n*(n-1)/2 {
+			t.Errorf("%v players: %v distinct games, expected %v", n, len(met), n*(n-1)/2)
+		}
+		for pair, count := range met {
+			if count != 1 {
+				t.Errorf("%v players: %v met %v times", n, pair, count)
+			}
+		}
+	}
+}
+
+func TestSwiss(t *testing.T) {
+	l := NewLeaderboard()
+	for i := 0; i < 5; i++ {
+		l.Add(fmt.Sprint(i), fmt.Sprint("bot", i))
+	}
+	played := map[Pair]bool{}
+
+	byes := map[string]bool{}
+	for round := 0; round < 4; round++ {
+		pairs := Swiss(l.Sorted(), played)
+		if len(pairs) != 3 {
+			t.Fatalf("round %v: expected 3 pairs, got %v", round, pairs)
+		}
+		for _, pair := range pairs {
+			if pair[1] == "" {
+				if byes[pair[0]] {
+					t.Errorf("round %v: second bye for %v", round, pair[0])
+				}
+				byes[pair[0]] = true
+				l.RecordBye(pair[0])
+				continue
+			}
+			if played[pair] || played[Pair{pair[1], pair[0]}] {
+				t.Errorf("round %v: rematch %v", round, pair)
+			}
+			played[pair] = true
+			l.RecordGame(pair[0], pair[1], 0)
+		}
+	}
+}
+
+func TestSwissWithoutPairings(t *testing.T) {
+	// two groups of 21 players who met everybody of the other group, they can't be paired without
+	// rematches and trying all pairings would never end
+	l := NewLeaderboard()
+	played := map[Pair]bool{}
+	for i := 0; i < 42; i++ {
+		l.Add(fmt.Sprint(i), fmt.Sprint("bot", i))
+		for j := 0; j < 42; j++ {
+			if i/21 != j/21 {
+				played[Pair{fmt.Sprint(i), fmt.Sprint(j)}] = true
+			}
+		}
+	}
+
+	pairs := Swiss(l.Sorted(), played)
+	seen := map[string]bool{}
+	rematches := 0
+	for _, pair := range pairs {
+		seen[pair[0]], seen[pair[1]] = true, true
+		if played[pair] {
+			rematches++
+		}
+	}
+	if len(pairs) != 21 || len(seen) != 42 || rematches != 1 {
+		t.Errorf("%d rematches in %v", rematches, pairs)
+	}
+}
+
+func TestUpdateElo(t *testing.T) {
+	a, b := UpdateElo(1500, 1500, 1)
+	if a != 1516 || b != 1484 {
+		t.Errorf("unexpected ratings after a win of equals: %v, %v", a, b)
+	}
+	a, b = UpdateElo(1700, 1500, 0.5)
+	if a >= 1700 || b <= 1500 || a+b != 3200 {
+		t.Errorf("unexpected ratings after a draw of the favourite: %v, %v", a, b)
+	}
+}
@@ -0,0 +1,485 @@
+package tournament
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"martinp/piskvorky/pisk"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	boardSize = 32
+	// the API speaks coordinates -15..16 like piskvorky.jobs.cz, see client.newGameFromCoordinates
+	coordinateOffset = 16
+)
+
+type Format string
+
+const (
+	FormatRoundRobin Format = "round-robin"
+	FormatSwiss      Format = "swiss"
+)
+
+type Config struct {
+	Format      Format
+	Rounds      int // number of Swiss rounds, round robin plays everybody once
+	TimeControl pisk.TimeControl
+	StateFile   string // users and leaderboard, loaded on start and saved after every game
+	GamesDir    string // finished games are saved here, empty to not save them
+	AdminToken  string // required to start a tournament, empty for no check
+}
+
+type user struct {
+	UserId    string `json:"userId"`
+	UserToken string `json:"userToken"`
+	Nickname  string `json:"nickname"`
+	Email     string `json:"email"`
+}
+
+// tournamentGame is one game of a round between two registered bots.
+type tournamentGame struct {
+	id      string
+	token   string
+	players [2]string // userIds of X and O
+	game    *pisk.Game
+}
+
+// state is what survives a restart of the server.
+type state struct {
+	Users       map[string]*user `json:"users"` // by userToken
+	Leaderboard *Leaderboard     `json:"leaderboard"`
+}
+
+// Server hosts tournaments between bots that register and play over HTTP.
+type Server struct {
+	config Config
+
+	mu       sync.Mutex
+	state    state
+	running  bool
+	round    int
+	rounds   [][]Pair // round robin schedule
+	played   map[Pair]bool
+	games    map[string]*tournamentGame // by gameToken
+	current  []*tournamentGame          // games of the running round
+	previous []*tournamentGame          // games of the round before, kept until its players learned the result
+}
+
+// NewServer creates a server and loads its state from config.StateFile if it exists.
+func NewServer(config Config) (*Server, error) {
+	s := &Server{
+		config: config,
+		state:  state{Users: map[string]*user{}, Leaderboard: NewLeaderboard()},
+		played: map[Pair]bool{},
+		games:  map[string]*tournamentGame{},
+	}
+	if config.StateFile != "" {
+		data, err := os.ReadFile(config.StateFile)
+		if err == nil {
+			err = json.Unmarshal(data, &s.state)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to load state: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/user", s.handleUser)
+	mux.HandleFunc("/api/v1/connect", s.handleConnect)
+	mux.HandleFunc("/api/v1/play", s.handlePlay)
+	mux.HandleFunc("/api/v1/checkStatus", s.handleCheckStatus)
+	mux.HandleFunc("/api/v1/tournament/start", s.handleStart)
+	mux.HandleFunc("/api/v1/leaderboard", s.handleLeaderboard)
+	return mux
+}
+
+// WatchClocks ends games of bots that ran out of time even if nobody asks about them.
+func (s *Server) WatchClocks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			for _, g := range s.current {
+				s.checkTime(g)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Start starts a tournament between all registered players.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return fmt.Errorf("tournament already running")
+	}
+	if len(s.state.Users) < 2 {
+		return fmt.Errorf("not enough players: %d", len(s.state.Users))
+	}
+	s.running = true
+	s.round = 0
+	s.played = map[Pair]bool{}
+	s.state.Leaderboard.ResetPoints()
+	if s.config.Format == FormatRoundRobin {
+		var players []string
+		for _, standing := range s.state.Leaderboard.Sorted() {
+			players = append(players, standing.UserId)
+		}
+		s.rounds = RoundRobin(players)
+	}
+	s.startRound()
+	return nil
+}
+
+func (s *Server) totalRounds() int {
+	if s.config.Format == FormatRoundRobin {
+		return len(s.rounds)
+	}
+	return s.config.Rounds
+}
+
+// startRound pairs the players for the next round, or ends the tournament after the last one.
+func (s *Server) startRound() {
+	// the games of the round before the last one are recorded and their players moved on
+	for _, g := range s.previous {
+		delete(s.games, g.token)
+	}
+	s.previous = s.current
+
+	if s.round >= s.totalRounds() {
+		s.running = false
+		s.current = nil
+		log.Println("Tournament finished")
+		return
+	}
+
+	var pairs []Pair
+	if s.config.Format == FormatRoundRobin {
+		pairs = s.rounds[s.round]
+	} else {
+		pairs = Swiss(s.state.Leaderboard.Sorted(), s.played)
+	}
+	s.round++
+
+	s.current = nil
+	for _, pair := range pairs {
+		if pair[1] == "" {
+			s.state.Leaderboard.RecordBye(pair[0])
+			continue
+		}
+		s.played[pair] = true
+		g := &tournamentGame{
+			id:      newToken(8),
+			token:   newToken(16),
+			players: pair,
+			game:    pisk.NewTimedGame(boardSize, s.nicknames(pair), s.config.TimeControl),
+		}
+		g.game.Log.Match = fmt.Sprintf("round %d of %d", s.round, s.totalRounds())
+		if g.game.Clock != nil {
+			g.game.Clock.Start(0) // X's clock runs from the pairing
+		}
+		s.games[g.token] = g
+		s.current = append(s.current, g)
+	}
+	log.Printf("Round %d: %d games", s.round, len(s.current))
+	if len(s.current) == 0 {
+		s.startRound()
+	}
+}
+
+func (s *Server) nicknames(pair Pair) [2]string {
+	return [2]string{s.state.Leaderboard.Standings[pair[0]].Nickname, s.state.Leaderboard.Standings[pair[1]].Nickname}
+}
+
+// checkTime ends the game if the player to move has run out of time.
+func (s *Server) checkTime(g *tournamentGame) {
+	if g.game.CheckTime(g.game.NextPlayer()) {
+		s.finishGame(g)
+	}
+}
+
+// finishGame records a finished game and starts the next round once all games of this one ended.
+func (s *Server) finishGame(g *tournamentGame) {
+	s.state.Leaderboard.RecordGame(g.players[0], g.players[1], g.game.Result().Winner())
+	if s.config.GamesDir != "" {
+		g.game.Log.SaveToFile(filepath.Join(s.config.GamesDir, fmt.Sprintf("tournament-%s.log", g.id)))
+	}
+	if err := s.saveState(); err != nil {
+		log.Println("Error saving state:", err)
+	}
+
+	for _, other := range s.current {
+		if !other.game.Result().Finished() {
+			return
+		}
+	}
+	s.startRound()
+}
+
+func (s *Server) saveState() error {
+	if s.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.config.StateFile, data, 0644)
+}
+
+func newToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// flexInt accepts both a JSON number and a string with a number, pisk/client sends strings.
+type flexInt int
+
+func (i *flexInt) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(s)
+	}
+	n, err := strconv.Atoi(string(data))
+	*i = flexInt(n)
+	return err
+}
+
+type request struct {
+	Nickname   string  `json:"nickname"`
+	Email      string  `json:"email"`
+	UserToken  string  `json:"userToken"`
+	GameToken  string  `json:"gameToken"`
+	PositionX  flexInt `json:"positionX"`
+	PositionY  flexInt `json:"positionY"`
+	AdminToken string  `json:"adminToken"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]interface{}{"statusCode": code, "errors": message})
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request) (*request, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "POST expected")
+		return nil, false
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Nickname == "" {
+		writeError(w, http.StatusBadRequest, "nickname required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &user{UserId: newToken(8), UserToken: newToken(16), Nickname: req.Nickname, Email: req.Email}
+	s.state.Users[u.UserToken] = u
+	s.state.Leaderboard.Add(u.UserId, u.Nickname)
+	if err := s.saveState(); err != nil {
+		log.Println("Error saving state:", err)
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"userId": u.UserId, "userToken": u.UserToken})
+}
+
+// userGame returns the unfinished game of the running round the user plays in.
+func (s *Server) userGame(u *user) *tournamentGame {
+	for _, g := range s.current {
+		if (g.players[0] == u.UserId || g.players[1] == u.UserId) && !g.game.Result().Finished() {
+			return g
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.state.Users[req.UserToken]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unknown userToken")
+		return
+	}
+	g := s.userGame(u)
+	if g == nil {
+		writeError(w, http.StatusConflict, "no game for the player in this round, try again later")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"gameId": g.id, "gameToken": g.token})
+}
+
+// authorizedGame looks up the user and the game of the request and checks that the user plays it.
+func (s *Server) authorizedGame(w http.ResponseWriter, req *request) (*user, *tournamentGame, bool) {
+	u, ok := s.state.Users[req.UserToken]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unknown userToken")
+		return nil, nil, false
+	}
+	g, ok := s.games[req.GameToken]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown gameToken")
+		return nil, nil, false
+	}
+	if g.players[0] != u.UserId && g.players[1] != u.UserId {
+		writeError(w, http.StatusForbidden, "not a player of this game")
+		return nil, nil, false
+	}
+	return u, g, true
+}
+
+func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, g, ok := s.authorizedGame(w, req)
+	if !ok {
+		return
+	}
+
+	s.checkTime(g)
+	if g.game.Result().Finished() {
+		writeJSON(w, http.StatusIMUsed, s.gameStatus(g))
+		return
+	}
+	player := g.game.NextPlayer()
+	if g.players[player] != u.UserId {
+		writeError(w, http.StatusNotAcceptable, "not your turn")
+		return
+	}
+	x, y := int(req.PositionX)+coordinateOffset, int(req.PositionY)+coordinateOffset
+	if x < 0 || y < 0 || x >= boardSize || y >= boardSize || !g.game.Play(pisk.Move{X: uint8(x), Y: uint8(y)}, player) {
+		if !g.game.Result().Finished() {
+			writeError(w, http.StatusBadRequest, "invalid move")
+			return
+		}
+	}
+	if g.game.Result().Finished() {
+		s.finishGame(g)
+	}
+	writeJSON(w, http.StatusCreated, s.gameStatus(g))
+}
+
+func (s *Server) handleCheckStatus(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, ok := s.authorizedGame(w, req)
+	if !ok {
+		return
+	}
+	s.checkTime(g)
+	code := http.StatusOK
+	if g.game.Result().Finished() {
+		code = http.StatusIMUsed // 226, the game is over
+	}
+	writeJSON(w, code, s.gameStatus(g))
+}
+
+// gameStatus returns the game in the shape of the piskvorky.jobs.cz checkStatus response.
+func (s *Server) gameStatus(g *tournamentGame) map[string]interface{} {
+	coordinates := make([]map[string]interface{}, 0, len(g.game.Log.Moves))
+	for i, move := range g.game.Log.Moves {
+		coordinates = append(coordinates, map[string]interface{}{
+			"x":        int(move.X) - coordinateOffset,
+			"y":        int(move.Y) - coordinateOffset,
+			"playerId": g.players[i%2],
+		})
+	}
+	status := map[string]interface{}{
+		"gameId":         g.id,
+		"playerCrossId":  g.players[0],
+		"playerCircleId": g.players[1],
+		"actualPlayerId": g.players[g.game.NextPlayer()],
+		"winnerId":       nil,
+		"result":         g.game.Result().String(),
+		"coordinates":    coordinates,
+	}
+	if winner := g.game.Result().Winner(); winner >= 0 {
+		status["winnerId"] = g.players[winner]
+	}
+	if g.game.Clock != nil {
+		status["remainingMs"] = []int64{
+			(g.game.Clock.Remaining[0] - g.game.Clock.Elapsed(0)).Milliseconds(),
+			(g.game.Clock.Remaining[1] - g.game.Clock.Elapsed(1)).Milliseconds(),
+		}
+	}
+	return status
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	if s.config.AdminToken != "" && req.AdminToken != s.config.AdminToken {
+		writeError(w, http.StatusUnauthorized, "invalid adminToken")
+		return
+	}
+	if err := s.Start(); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"statusCode": http.StatusCreated})
+}
+
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"running":   s.running,
+		"round":     s.round,
+		"rounds":    s.totalRounds(),
+		"standings": s.state.Leaderboard.Sorted(),
+	})
+}
@@ -0,0 +1,160 @@
+package tournament
+
+import (
+	"martinp/piskvorky/client"
+	"martinp/piskvorky/pisk"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTournament(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	server, err := NewServer(Config{
+		Format:      FormatRoundRobin,
+		TimeControl: pisk.TimeControl{Initial: time.Minute},
+		StateFile:   stateFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	api := client.NewAPIClient(ts.URL)
+
+	alice, err := api.RegisterPlayer("alice", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := api.RegisterPlayer("bob", "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.StartGame(alice.UserToken); err == nil {
+		t.Error("connected before the tournament started")
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	aliceGame, err := api.StartGame(alice.UserToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobGame, err := api.StartGame(bob.UserToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliceGame.GameToken != bobGame.GameToken {
+		t.Fatalf("players got different games")
+	}
+
+	// whoever plays X makes five on row 0, O plays on row 5
+	x, o := alice, bob
+	if code, status, _ := api.CheckGameStatus(alice.UserToken, aliceGame.GameToken); code != 200 || status["playerCrossId"] != alice.UserId {
+		x, o = bob, alice
+	}
+	if _, err := api.Play(o.UserToken, aliceGame.GameToken, 1, 5); err == nil {
+		t.Error("O played out of turn")
+	}
+	for i := uint(0); i < 5; i++ {
+		if _, err := api.Play(x.UserToken, aliceGame.GameToken, i, 0); err != nil {
+			t.Fatal(err)
+		}
+		if i < 4 {
+			if _, err := api.Play(o.UserToken, aliceGame.GameToken, i, 5); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	code, status, err := api.CheckGameStatus(alice.UserToken, aliceGame.GameToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 226 || status["winnerId"] != x.UserId || len(status["coordinates"].([]interface{})) != 9 {
+		t.Errorf("unexpected status %v: %v", code, status)
+	}
+
+	// the only round is over, the state survives a restart
+	restarted, err := NewServer(Config{StateFile: stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	standings := restarted.state.Leaderboard.Sorted()
+	if restarted.running || standings[0].UserId != x.UserId || standings[0].Rating <= InitialRating || standings[1].Losses != 1 {
+		t.Errorf("unexpected standings after restart: %+v, %+v", standings[0], standings[1])
+	}
+}
+
+func TestLossOnTime(t *testing.T) {
+	server, err := NewServer(Config{Format: FormatSwiss, Rounds: 1, TimeControl: pisk.TimeControl{Initial: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	api := client.NewAPIClient(ts.URL)
+
+	alice, _ := api.RegisterPlayer("alice", "")
+	bob, _ := api.RegisterPlayer("bob", "")
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	game, err := api.StartGame(alice.UserToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	code, status, err := api.CheckGameStatus(bob.UserToken, game.GameToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 226 || status["result"] != "o-wins time" {
+		t.Errorf("expected a loss on time, got %v: %v", code, status)
+	}
+}
+
+func TestFinishedGamesEvicted(t *testing.T) {
+	server, err := NewServer(Config{Format: FormatSwiss, Rounds: 3, TimeControl: pisk.TimeControl{Initial: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	api := client.NewAPIClient(ts.URL)
+
+	alice, _ := api.RegisterPlayer("alice", "")
+	bob, _ := api.RegisterPlayer("bob", "")
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var tokens []string
+	for round := 0; round < 3; round++ {
+		game, err := api.StartGame(alice.UserToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, game.GameToken)
+		time.Sleep(5 * time.Millisecond)
+		// lost on time, the next round starts
+		if code, _, err := api.CheckGameStatus(alice.UserToken, game.GameToken); err != nil || code != 226 {
+			t.Fatalf("round %d: %v %v", round, code, err)
+		}
+	}
+
+	// the last game is kept for bob to learn the result
+	if code, _, err := api.CheckGameStatus(bob.UserToken, tokens[2]); err != nil || code != 226 {
+		t.Errorf("the last game: %v %v", code, err)
+	}
+	if _, _, err := api.CheckGameStatus(bob.UserToken, tokens[1]); err == nil {
+		t.Error("the game of the round before the last one wasn't evicted")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.games) != 1 {
+		t.Errorf("%d games kept", len(server.games))
+	}
+}